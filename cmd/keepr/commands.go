@@ -0,0 +1,274 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"git.tcp.direct/kayos/keepr/internal/collect"
+	"git.tcp.direct/kayos/keepr/internal/config"
+	"git.tcp.direct/kayos/keepr/internal/filter"
+	qry "git.tcp.direct/kayos/keepr/internal/query"
+)
+
+func query() error {
+	expr, err := queryExpr()
+	if err != nil {
+		return err
+	}
+	log.Debug().Str("query", expr.String()).Msg("parsed query")
+	ranges, err := parseRanges()
+	if err != nil {
+		return err
+	}
+	results := collect.Library.Filter(func(s *collect.Sample) bool {
+		return expr.Match(s) && matchRanges(s, ranges)
+	})
+	if config.SortBy != "" {
+		if err := collect.SortSamples(results, config.SortBy); err != nil {
+			return err
+		}
+	}
+	if config.LinkDir != "" {
+		if err := collect.LinkInto(results, config.LinkDir); err != nil {
+			return err
+		}
+		waitBacklog()
+		log.Info().Str("path", config.LinkDir).Int("results", len(results)).Msg("linked query results")
+	}
+	switch config.Format {
+	case "", "paths":
+		for _, s := range results {
+			fmt.Println(s.Path)
+		}
+	case "none":
+	default:
+		if err := collect.WriteRecords(os.Stdout, config.Format, collect.Library.Records(results)); err != nil {
+			return err
+		}
+	}
+	log.Debug().Int("results", len(results)).Msg("query finished")
+	return nil
+}
+
+// queryExpr parses the query expression arguments, along with the shorthand flags as if they were part of it.
+func queryExpr() (qry.Expr, error) {
+	var clauses []string
+	shorthand := func(field, value string) {
+		if value != "" {
+			clauses = append(clauses, field+"="+strconv.Quote(value))
+		}
+	}
+	shorthand("key", config.QueryKey)
+	shorthand("type", config.QueryType)
+	shorthand("timesig", strings.ReplaceAll(config.QueryTimeSig, "-", "/"))
+	shorthand("instrument", config.QueryInstrument)
+	if config.QueryTempo != 0 {
+		shorthand("tempo", strconv.Itoa(config.QueryTempo))
+	}
+	if config.QueryBars != 0 {
+		shorthand("bars", strconv.Itoa(config.QueryBars))
+	}
+
+	// the arguments are one expression however the shell split it, e.g. key=A minor
+	args := strings.Join(config.Args, " ")
+	expr, err := qry.Parse(args)
+	if err != nil {
+		return nil, fmt.Errorf("bad query %q: %w", args, err)
+	}
+	exprs := []qry.Expr{expr}
+	for _, clause := range clauses {
+		if expr, err = qry.Parse(clause); err != nil {
+			return nil, fmt.Errorf("bad query %q: %w", clause, err)
+		}
+		exprs = append(exprs, expr)
+	}
+	return qry.And(exprs...), nil
+}
+
+func parseRanges() ([]*collect.Range, error) {
+	var ranges []*collect.Range
+	for _, spec := range config.Ranges {
+		r, err := collect.ParseRange(spec)
+		if err != nil {
+			return nil, err
+		}
+		ranges = append(ranges, r)
+	}
+	return ranges, nil
+}
+
+func matchRanges(s *collect.Sample, ranges []*collect.Range) bool {
+	for _, r := range ranges {
+		if !r.Match(s) {
+			return false
+		}
+	}
+	return true
+}
+
+func export() error {
+	ranges, err := parseRanges()
+	if err != nil {
+		return err
+	}
+	samples := collect.Library.Filter(func(s *collect.Sample) bool { return matchRanges(s, ranges) })
+	if config.SortBy != "" {
+		if err := collect.SortSamples(samples, config.SortBy); err != nil {
+			return err
+		}
+	}
+	format := config.Format
+	if format == "" {
+		format = exportFormat(config.ExportFile)
+	}
+	var w io.Writer = os.Stdout
+	if config.ExportFile != "" {
+		f, err := os.Create(config.ExportFile)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+	records := collect.Library.Records(samples)
+	if config.ExportPeaks {
+		for i, s := range samples {
+			if !s.HasAudio() {
+				continue
+			}
+			if records[i].Peaks, err = s.LoadPeaks(); err != nil {
+				log.Warn().Str("path", s.Path).Err(err).Msg("no peaks")
+			}
+		}
+	}
+	return collect.WriteRecords(w, format, records)
+}
+
+// thumbs renders the thumbnails of every cataloged WAV file that lacks fresh ones, a worker per CPU.
+func thumbs() {
+	work := make(chan *collect.Sample)
+	var rendered, failed int32
+	var wg sync.WaitGroup
+	for i := 0; i < runtime.NumCPU(); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for s := range work {
+				did, err := s.Thumbnails()
+				switch {
+				case err != nil:
+					log.Warn().Str("path", s.Path).Err(err).Msg("failed to render thumbnails")
+					atomic.AddInt32(&failed, 1)
+				case did:
+					atomic.AddInt32(&rendered, 1)
+				}
+			}
+		}()
+	}
+	for _, s := range collect.Library.Samples {
+		if s.HasAudio() {
+			work <- s
+		}
+	}
+	close(work)
+	wg.Wait()
+	log.Info().Str("path", config.StatePath("thumbs")).Int32("rendered", rendered).Int32("failed", failed).Msg("thumbnails up to date")
+}
+
+// exportFormat guesses the export format from the file extension, JSON unless it says otherwise.
+func exportFormat(path string) string {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".csv":
+		return "csv"
+	case ".ndjson", ".jsonl":
+		return "ndjson"
+	}
+	return "json"
+}
+
+func prune() error {
+	removed, err := collect.Prune(config.Output)
+	if err != nil {
+		return err
+	}
+	log.Info().Int("removed", len(removed)).Msg("pruned output directory")
+	return nil
+}
+
+func verify() error {
+	problems, err := collect.Library.Verify(config.Output)
+	if err != nil {
+		return err
+	}
+	counts := make(map[string]int)
+	for _, p := range problems {
+		log.Warn().Str("path", p.Path).Str("problem", p.Kind).Msg(p.Detail)
+		counts[p.Kind]++
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("found %d dangling, %d misclassified and %d stray entries",
+			counts[collect.ProblemDangling], counts[collect.ProblemMisclassified], counts[collect.ProblemStray])
+	}
+	log.Info().Msg("every entry matches the catalog")
+	return nil
+}
+
+// repair looks for the cataloged samples that went missing under the source roots, and relinks the ones found.
+func repair() error {
+	missing := collect.Library.Missing()
+	if len(missing) == 0 {
+		log.Info().Msg("no cataloged files are missing, nothing to repair")
+		return nil
+	}
+	log.Info().Int("missing", len(missing)).Msg("looking for moved files")
+
+	filters := make(map[*config.SourceRoot]*filter.Filter)
+	for _, root := range config.Sources {
+		filt, err := newFilter(root, os.DirFS(root.Path))
+		if err != nil {
+			return err
+		}
+		filters[root] = filt
+	}
+	moved := collect.Library.Relocate(missing, config.Sources, func(root *config.SourceRoot, rel string, isDir bool) bool {
+		skip, _ := filters[root].Skip(rel, isDir)
+		return skip
+	})
+	for _, s := range missing {
+		if old, ok := moved[s]; ok {
+			log.Info().Str("path", old).Str("found", s.Path).Msg("relocated")
+		} else {
+			log.Warn().Str("path", s.Path).Msg("not found")
+		}
+	}
+	if len(moved) == 0 {
+		return fmt.Errorf("none of the %d missing files were found", len(missing))
+	}
+
+	// sort the relocated samples into their new source roots' views
+	old := collect.Library
+	collect.Library = old.Without(func(*collect.Sample) bool { return false })
+	relinked := collect.Library.Relink(old, moved)
+	waitBacklog()
+
+	if config.Simulate {
+		log.Info().Msg("simulating, not saving catalog")
+	} else {
+		if err := collect.Library.SaveCatalog(config.CatalogPath()); err != nil {
+			return err
+		}
+		log.Info().Str("path", config.CatalogPath()).Int("samples", len(collect.Library.Samples)).Msg("saved catalog")
+	}
+	log.Info().Int("relocated", len(moved)).Int("links", relinked).Msg("repaired")
+	if left := len(missing) - len(moved); left > 0 {
+		return fmt.Errorf("%d files are still missing", left)
+	}
+	return nil
+}
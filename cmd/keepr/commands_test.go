@@ -0,0 +1,37 @@
+package main
+
+import (
+	"testing"
+
+	"gopkg.in/music-theory.v0/key"
+
+	"git.tcp.direct/kayos/keepr/internal/collect"
+	"git.tcp.direct/kayos/keepr/internal/config"
+)
+
+func TestQueryExpr(t *testing.T) {
+	defer func(args []string, typ string) { config.Args, config.QueryType = args, typ }(config.Args, config.QueryType)
+	loop := &collect.Sample{
+		Name: "pad_loop_Am.wav", Key: key.Of("Am"),
+		Types: map[collect.SampleType]struct{}{collect.TypeLoop: {}},
+	}
+	oneShot := &collect.Sample{
+		Name: "pad_Am.wav", Key: key.Of("Am"),
+		Types: map[collect.SampleType]struct{}{collect.TypeOneShot: {}},
+	}
+
+	// split by the shell the way it would be without quotes
+	config.Args, config.QueryType = []string{"key=A", "minor", "or", "key=C"}, "loop"
+	expr, err := queryExpr()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !expr.Match(loop) || expr.Match(oneShot) {
+		t.Errorf("%s matches loop %v, one-shot %v", expr, expr.Match(loop), expr.Match(oneShot))
+	}
+
+	config.Args = []string{"key=A", "("}
+	if _, err := queryExpr(); err == nil {
+		t.Error("unbalanced query should fail")
+	}
+}
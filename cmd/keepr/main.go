@@ -1,88 +1,207 @@
 package main
 
 import (
+	"math"
 	"os"
 	"path/filepath"
-	"runtime"
 	"strings"
 	"sync/atomic"
 	"time"
 
 	"github.com/rs/zerolog"
-	"kr.dev/walk"
 
 	"git.tcp.direct/kayos/keepr/internal/collect"
 	"git.tcp.direct/kayos/keepr/internal/config"
+	"git.tcp.direct/kayos/keepr/internal/progress"
 	"git.tcp.direct/kayos/keepr/internal/util"
 )
 
-var (
-	log      *zerolog.Logger
-	basepath = "/"
-)
-
-func init() {
-	if runtime.GOOS == "windows" {
-		// TODO: fix this garbage
-		basepath = "C:\\"
-	}
-}
+var log *zerolog.Logger
 
 func main() {
 	config.KeeprInit()
 	log = config.GetLogger()
-	var lastpath = ""
-	target := strings.TrimSuffix(strings.TrimPrefix(strings.TrimSpace(config.Source), "/"), "/")
-	cripwalk := walk.New(os.DirFS(basepath), target)
-	_, output := filepath.Split(strings.TrimSuffix(config.Output, "/"))
-	log.Trace().Msgf("output is %s", output)
-	for cripwalk.Next() {
-		if err := cripwalk.Err(); err != nil {
-			log.Fatal().Caller().Str("caller", lastpath).Msg(err.Error())
-			continue
+
+	var err error
+	switch config.Command {
+	case "", "scan":
+		collect.Run = collect.NewReport(config.Command)
+	}
+	stopProgress := func() {}
+	switch config.Command {
+	case "", "scan", "link":
+		if !config.Quiet {
+			stopProgress = progress.Show(os.Stderr, 10*time.Second, logProgress)
+		}
+	}
+	switch config.Command {
+	case "scan":
+		err = scan()
+	case "link":
+		if err = load(); err == nil {
+			err = linkLibrary()
+		}
+	case "watch":
+		err = watchSources()
+	case "stats":
+		if err = load(); err == nil {
+			stats()
+		}
+	case "query":
+		if err = load(); err == nil {
+			err = query()
+		}
+	case "export":
+		if err = load(); err == nil {
+			err = export()
+		}
+	case "mount":
+		if err = load(); err == nil {
+			err = mountLibrary()
+		}
+	case "thumbs":
+		if err = load(); err == nil {
+			thumbs()
 		}
-		lastpath = cripwalk.Path()
-		slog := log.With().Str("caller", cripwalk.Path()).Logger()
-		switch {
-		case cripwalk.Entry() == nil:
-			slog.Trace().Msg("nil")
-			continue
-		case cripwalk.Entry().IsDir():
-			if strings.Contains(cripwalk.Path(), output) {
-				slog.Info().Msg("skiping directory entirely")
-				cripwalk.SkipDir()
-			}
-			continue
-			// slog.Trace().Msg("directory")
-		default:
-			if strings.Contains(cripwalk.Path(), config.Output) {
-				log.Trace().Msg("skipping file in destination")
-				cripwalk.SkipDir()
-				continue
-			}
-			sample, err := collect.Process(cripwalk.Entry(), util.APath(cripwalk.Path(), config.Relative))
-			if err != nil {
-				slog.Warn().Caller().Str("caller", cripwalk.Path()).Err(err).Msgf("failed to process")
-				continue
-			}
-			if sample == nil {
-				slog.Trace().Msgf("skipping unknown file")
-				continue
-			}
-			slog.Info().Interface("sample", sample).Msg("processed")
+	case "serve":
+		if err = load(); err == nil {
+			err = serveHTTP()
+		}
+	case "report":
+		var r *collect.Report
+		if r, err = collect.LoadReport(config.StatePath("report.json")); err == nil {
+			err = r.WriteSummary(os.Stdout, 0)
+		}
+	case "rollback":
+		if err = collect.Rollback(config.Output); err == nil {
+			log.Info().Str("path", config.Output).Msg("rolled back to the previous library")
+		}
+	case "prune":
+		err = prune()
+	case "verify":
+		if err = load(); err == nil {
+			err = verify()
+		}
+	case "repair":
+		if err = load(); err == nil {
+			err = repair()
+		}
+	default:
+		if err = scan(); err != nil {
+			break
+		}
+		if config.StatsOnly {
+			stats()
+			break
+		}
+		err = linkLibrary()
+	}
+	stopProgress()
+	finishReport()
+	if err != nil {
+		log.Fatal().Err(err).Msg("failed to " + strings.TrimSpace(config.Command+" library"))
+	}
+}
+
+// load replaces collect.Library with the catalog saved by a previous scan.
+func load() error {
+	lib, err := collect.LoadCatalog(config.CatalogPath())
+	if err != nil {
+		return err
+	}
+	collect.Library = lib
+	log.Debug().Int("samples", len(lib.Samples)).Msg("loaded catalog")
+	return nil
+}
+
+func stats() {
+	log.Info().Msg("Printing stats")
+	collect.Library.TempoStats()
+	collect.Library.KeyStats()
+	collect.Library.DrumStats()
+	collect.Library.TypeStats()
+	collect.Library.RootStats()
+}
+
+// linkLibrary runs linkAll, with --atomic in a staging directory that then replaces the output tree,
+// so that nobody browsing the library sees it half built.
+func linkLibrary() error {
+	if !config.Atomic || config.Simulate || config.PlaylistsOnly {
+		linkAll()
+		return nil
+	}
+	output := config.Output
+	staging, err := collect.Stage(output)
+	if err != nil {
+		return err
+	}
+	config.Output = staging
+	linkAll()
+	config.Output = output
+	if err = collect.Swap(output, staging); err != nil {
+		return err
+	}
+	log.Info().Str("path", output).Str("previous", collect.PreviousPath(output)).Msg("swapped in the new library")
+	return nil
+}
+
+// finishReport saves the report of the run, if there is one, and prints a summary of it.
+func finishReport() {
+	if collect.Run == nil {
+		return
+	}
+	collect.Run.Finish(collect.Library)
+	if !config.Simulate {
+		path := config.StatePath("report.json")
+		if err := collect.Run.Save(path); err != nil {
+			log.Warn().Str("path", path).Err(err).Msg("failed to save run report")
 		}
 	}
+	_ = collect.Run.WriteSummary(os.Stderr, 10)
+}
 
-	if config.StatsOnly {
-		log.Info().Msg("Printing stats")
-		collect.Library.TempoStats()
-		collect.Library.KeyStats()
-		collect.Library.DrumStats()
-		collect.Library.TypeStats()
+// logProgress logs the stats of a phase, when there is no terminal to show them on.
+func logProgress(s progress.Stats) {
+	round := func(f float64) float64 { return math.Round(f*100) / 100 }
+	ev := log.Info().Str("phase", s.Phase).Int64("files", s.Files).Float64("files_per_sec", round(s.FilesPerSec()))
+	if s.Bytes > 0 {
+		ev = ev.Int64("bytes", s.Bytes).Float64("mb_per_sec", round(s.MBPerSec()))
+	}
+	if left := s.Remaining(); left >= 0 {
+		ev = ev.Int64("total", s.Total).Int64("remaining", left)
+	}
+	if eta := s.ETA(); eta > 0 {
+		ev = ev.Dur("eta", eta)
+	}
+	if s.Done {
+		ev.Dur("took", s.Elapsed).Msg("phase done")
 		return
 	}
+	ev.Msg("progress")
+}
 
+func linkAll() {
+	defer collect.Run.Phase("link")()
 	var errs []error
+	formats := config.Playlists
+	if len(formats) == 0 && config.PlaylistsOnly {
+		formats = []string{"m3u8"}
+	}
+	if len(formats) > 0 {
+		dir := util.APath(filepath.Join(config.Output, "Playlists"))
+		written, err := collect.Library.WritePlaylists(dir, formats)
+		errs = append(errs, err)
+		log.Info().Str("path", dir).Int("playlists", written).Msg("wrote playlists")
+	}
+	if config.PlaylistsOnly {
+		log.Info().Errs("errs", errs).Msg("fin.")
+		return
+	}
+	total := 0
+	for _, samples := range collect.Library.Views() {
+		total += len(samples)
+	}
+	phase := progress.Begin(collect.PhaseLink, total, 0)
 	errs = append(errs, collect.Library.SymlinkTempos())
 	errs = append(errs, collect.Library.SymlinkKeys())
 	errs = append(errs, collect.Library.SymlinkDrums())
@@ -91,13 +210,22 @@ func main() {
 	errs = append(errs, collect.Library.SymlinkArtists())
 	errs = append(errs, collect.Library.SymlinkGenres())
 	errs = append(errs, collect.Library.SymlinkSources())
+	errs = append(errs, collect.Library.SymlinkRoots())
 	errs = append(errs, collect.Library.SymlinkCreationDates())
 	errs = append(errs, collect.Library.SymlinkSoftwares())
 
+	waitBacklog()
+	phase.End()
+
+	log.Info().Errs("errs", errs).Msg("fin.")
+}
+
+// waitBacklog waits for the links being made in the background, whose progress shows in the phase
+// under way, if any.
+func waitBacklog() {
 	for !atomic.CompareAndSwapInt32(&collect.Backlog, 0, -1) {
 		time.Sleep(1 * time.Second)
-		print(".")
 	}
-
-	log.Info().Errs("errs", errs).Msg("fin.")
+	atomic.StoreInt32(&collect.Backlog, 0)
+	collect.ReportFallbacks()
 }
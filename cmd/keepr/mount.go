@@ -0,0 +1,93 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"os/signal"
+	"path"
+	"syscall"
+	"time"
+
+	"git.tcp.direct/kayos/keepr/internal/collect"
+	"git.tcp.direct/kayos/keepr/internal/config"
+	"git.tcp.direct/kayos/keepr/internal/mount"
+	qry "git.tcp.direct/kayos/keepr/internal/query"
+	"git.tcp.direct/kayos/keepr/internal/util"
+)
+
+// reloadInterval is how often mount checks whether the catalog was saved again, by scan or watch.
+const reloadInterval = 5 * time.Second
+
+// mountLibrary mounts the views of collect.Library and the saved queries at the directory
+// given as argument, following catalog updates until interrupted or unmounted.
+func mountLibrary() error {
+	if len(config.Args) != 1 {
+		return errors.New("mount needs exactly one directory to mount on")
+	}
+	dir := util.APath(config.Args[0])
+	queries := make(map[string]qry.Expr, len(config.Queries))
+	for name, q := range config.Queries {
+		expr, err := qry.Parse(q)
+		if err != nil {
+			return errors.New("saved query " + name + ": " + err.Error())
+		}
+		queries[name] = expr
+	}
+	tree := func() *mount.Tree {
+		views := collect.Library.Views()
+		for name, expr := range queries {
+			views[path.Join("Queries", name)] = collect.Library.Filter(expr.Match)
+		}
+		return mount.NewTree(views)
+	}
+
+	m, err := mount.New(dir, tree())
+	if err != nil {
+		return err
+	}
+	log.Info().Str("path", dir).Int("samples", len(collect.Library.Samples)).Int("queries", len(queries)).Msg("mounted")
+
+	catalogTime := func() time.Time {
+		fi, err := os.Stat(config.CatalogPath())
+		if err != nil {
+			return time.Time{}
+		}
+		return fi.ModTime()
+	}
+	loaded := catalogTime()
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(reloadInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+			}
+			if saved := catalogTime(); saved.After(loaded) {
+				if err := load(); err != nil {
+					log.Warn().Err(err).Msg("failed to reload catalog")
+					continue
+				}
+				loaded = saved
+				m.Update(tree())
+				log.Info().Int("samples", len(collect.Library.Samples)).Msg("catalog changed, updated mount")
+			}
+		}
+	}()
+
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		for range sigs {
+			log.Info().Str("path", dir).Msg("unmounting")
+			if err := m.Unmount(); err != nil {
+				log.Warn().Str("path", dir).Err(err).Msg("failed to unmount, close whatever is using it and try again")
+			}
+		}
+	}()
+	m.Wait()
+	close(done)
+	return nil
+}
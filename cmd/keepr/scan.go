@@ -0,0 +1,266 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"kr.dev/walk"
+
+	"git.tcp.direct/kayos/keepr/internal/collect"
+	"git.tcp.direct/kayos/keepr/internal/config"
+	"git.tcp.direct/kayos/keepr/internal/filter"
+	"git.tcp.direct/kayos/keepr/internal/progress"
+	"git.tcp.direct/kayos/keepr/internal/util"
+)
+
+// scanner walks source roots, it remembers what it has seen across roots so that
+// a file reachable by several paths (hardlinks, symlinks, overlapping roots) is only ingested once.
+type scanner struct {
+	files map[interface{}]string
+	dirs  map[interface{}]string
+	// outputs identify outputDirs, those that exist.
+	outputs []interface{}
+	// unchanged, if set, reports files that are already cataloged as they are now, they aren't processed again.
+	unchanged func(path string, info fs.FileInfo) bool
+	// queue holds the files walked but not processed yet.
+	queue []queued
+}
+
+// queued is a file found by a walk, to be processed.
+type queued struct {
+	entry fs.DirEntry
+	path  string
+	root  string
+	size  int64
+}
+
+func newScanner() *scanner {
+	s := &scanner{
+		files: make(map[interface{}]string),
+		dirs:  make(map[interface{}]string),
+	}
+	for _, dir := range outputDirs() {
+		if fi, err := os.Stat(dir); err == nil {
+			if id, err := identity(dir, fi); err == nil {
+				s.outputs = append(s.outputs, id)
+			}
+		}
+	}
+	return s
+}
+
+// outputDirs are our output directory and the generations of it an atomic link keeps next to it.
+func outputDirs() []string {
+	return collect.Generations(config.Output)
+}
+
+// isOutput reports whether the directory at path is one of outputDirs, under whatever name.
+func (s *scanner) isOutput(path string, fi fs.FileInfo) bool {
+	for _, dir := range outputDirs() {
+		if path == dir {
+			return true
+		}
+	}
+	id, err := identity(path, fi)
+	if err != nil {
+		return false
+	}
+	for _, out := range s.outputs {
+		if id == out {
+			return true
+		}
+	}
+	return false
+}
+
+// identity returns a key identifying the file at path, following symlinks: its device
+// and inode when the platform has them, its fully resolved path when it doesn't.
+func identity(path string, fi fs.FileInfo) (interface{}, error) {
+	if id, ok := util.FileIDOf(fi); ok {
+		return id, nil
+	}
+	return filepath.EvalSymlinks(path)
+}
+
+// firstVisit records path in seen, returning the path it was first seen as if it isn't new.
+func firstVisit(seen map[interface{}]string, path string, fi fs.FileInfo) (string, bool) {
+	id, err := identity(path, fi)
+	if err != nil {
+		return "", true
+	}
+	if first, ok := seen[id]; ok {
+		return first, false
+	}
+	seen[id] = path
+	return "", true
+}
+
+// scan walks every source root, processing every file we find into collect.Library, and saves the catalog.
+func scan() error {
+	s := newScanner()
+	walking := progress.Begin(collect.PhaseScan, 0, 0)
+	for _, root := range config.Sources {
+		log.Info().Str("path", root.Path).Str("root", root.Label).Msg("scanning source root")
+		done := collect.Run.Phase("scan " + root.Label)
+		err := s.scanRoot(root)
+		done()
+		if err != nil {
+			return err
+		}
+	}
+	walking.End()
+	s.process()
+
+	waitBacklog()
+
+	if config.Simulate {
+		log.Info().Msg("simulating, not saving catalog")
+		return nil
+	}
+	if err := collect.Library.SaveCatalog(config.CatalogPath()); err != nil {
+		return err
+	}
+	log.Info().Str("path", config.CatalogPath()).Int("samples", len(collect.Library.Samples)).Msg("saved catalog")
+	return nil
+}
+
+// scanRoot walks a single source root.
+func (s *scanner) scanRoot(root *config.SourceRoot) error {
+	fsys := os.DirFS(root.Path)
+	filt, err := newFilter(root, fsys)
+	if err != nil {
+		return err
+	}
+	s.walk(root, fsys, filt, ".")
+	return nil
+}
+
+// newFilter creates the walker filter of a source root.
+func newFilter(root *config.SourceRoot, fsys fs.FS) (*filter.Filter, error) {
+	filt, err := filter.New(fsys, ".", filter.Options{
+		Include:   config.Include,
+		Exclude:   append(append([]string{}, config.Exclude...), root.Exclude...),
+		NoBuiltin: config.NoDefaultIgnores,
+		Warn: func(err error) {
+			log.Warn().Str("root", root.Label).Err(err).Msg("bad ignore file")
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("bad filters for source %s: %w", root.Label, err)
+	}
+	return filt, nil
+}
+
+// walk walks target, a slash separated path inside the root's fsys. When following
+// symlinks it calls itself for every symlinked directory it hasn't been in before.
+func (s *scanner) walk(root *config.SourceRoot, fsys fs.FS, filt *filter.Filter, target string) {
+	var lastpath = ""
+	cripwalk := walk.New(fsys, target)
+	log.Trace().Msgf("output is %s", config.Output)
+	for cripwalk.Next() {
+		if err := cripwalk.Err(); err != nil {
+			log.Error().Caller().Str("path", lastpath).Msg(err.Error())
+			collect.Run.Fail(lastpath, "walk", err)
+			continue
+		}
+		lastpath = cripwalk.Path()
+		path := filepath.Join(root.Path, filepath.FromSlash(cripwalk.Path()))
+		slog := log.With().Str("path", path).Str("phase", collect.PhaseScan).Logger()
+		entry := cripwalk.Entry()
+		if entry == nil {
+			slog.Trace().Msg("nil")
+			continue
+		}
+		if target != "." && cripwalk.Path() == target {
+			// the symlinked directory itself, our caller already dealt with it
+			continue
+		}
+		isLink := entry.Type()&fs.ModeSymlink != 0
+		info, err := entry.Info()
+		if err == nil && isLink {
+			// we want to know about whatever the link points at
+			info, err = os.Stat(path)
+		}
+		if err != nil {
+			slog.Warn().Err(err).Msg("can't stat, skipping")
+			collect.Run.Fail(path, "stat", err)
+			continue
+		}
+		if skip, reason := filt.Skip(cripwalk.Path(), info.IsDir()); skip {
+			slog.Debug().Str("reason", reason).Msg("skipping")
+			collect.Run.Skip("filtered")
+			if entry.IsDir() {
+				cripwalk.SkipDir()
+			}
+			continue
+		}
+		switch {
+		case info.IsDir():
+			if s.isOutput(path, info) {
+				slog.Info().Msg("skiping output directory entirely")
+				cripwalk.SkipDir()
+				continue
+			}
+			if !config.FollowSymlinks {
+				if isLink {
+					slog.Debug().Msg("not following symlinked directory")
+				}
+				continue
+			}
+			if first, ok := firstVisit(s.dirs, path, info); !ok {
+				slog.Warn().Str("first", first).Msg("already walked this directory, skipping (symlink loop?)")
+				if entry.IsDir() {
+					cripwalk.SkipDir()
+				}
+				continue
+			}
+			if isLink {
+				s.walk(root, fsys, filt, cripwalk.Path())
+			}
+		default:
+			if first, ok := firstVisit(s.files, path, info); !ok {
+				slog.Debug().Str("first", first).Msg("already processed via another path, skipping")
+				collect.Run.Skip("duplicate")
+				continue
+			}
+			if s.unchanged != nil && s.unchanged(path, info) {
+				slog.Trace().Msg("unchanged")
+				collect.Run.Skip("unchanged")
+				continue
+			}
+			s.queue = append(s.queue, queued{entry: entry, path: path, root: root.Label, size: info.Size()})
+			progress.Add(0)
+		}
+	}
+}
+
+// process analyzes every file queued by the walks into collect.Library.
+func (s *scanner) process() {
+	var bytes int64
+	for _, q := range s.queue {
+		bytes += q.size
+	}
+	defer collect.Run.Phase(collect.PhaseAnalysis)()
+	phase := progress.Begin(collect.PhaseAnalysis, len(s.queue), bytes)
+	defer phase.End()
+	for _, q := range s.queue {
+		slog := log.With().Str("path", q.path).Str("phase", collect.PhaseAnalysis).Logger()
+		sample, err := collect.Process(q.entry, q.path, q.root)
+		progress.Add(q.size)
+		if err != nil {
+			slog.Warn().Caller().Err(err).Msgf("failed to process")
+			collect.Run.Fail(q.path, "analysis", err)
+			continue
+		}
+		if sample == nil {
+			slog.Trace().Msgf("skipping unknown file")
+			collect.Run.Skip("unsupported")
+			continue
+		}
+		slog.Info().Interface("sample", sample).Msg("processed")
+		collect.Run.AddProcessed()
+	}
+	s.queue = nil
+}
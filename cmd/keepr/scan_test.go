@@ -0,0 +1,95 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"git.tcp.direct/kayos/keepr/internal/collect"
+	"git.tcp.direct/kayos/keepr/internal/config"
+)
+
+// scanTree scans src as the only source root, with --fast so that empty WAVs do, and returns the
+// scanner and the paths cataloged.
+func scanTree(t *testing.T, src string) (*scanner, []string) {
+	t.Helper()
+	log = config.GetLogger()
+	defer func(lib *collect.Collection, fast bool) { collect.Library, config.SkipWavDecode = lib, fast }(collect.Library, config.SkipWavDecode)
+	collect.Library, config.SkipWavDecode = collect.NewCollection(), true
+
+	s := newScanner()
+	if err := s.scanRoot(&config.SourceRoot{Path: src, Label: "src"}); err != nil {
+		t.Fatal(err)
+	}
+	s.process()
+	var paths []string
+	for _, sample := range collect.Library.Samples {
+		paths = append(paths, sample.Path)
+	}
+	sort.Strings(paths)
+	return s, paths
+}
+
+func writeFiles(t *testing.T, paths ...string) {
+	t.Helper()
+	for _, path := range paths {
+		if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestScanSkipsOutputGenerations(t *testing.T) {
+	src := t.TempDir()
+	defer func(o string) { config.Output = o }(config.Output)
+	config.Output = filepath.Join(src, "out")
+	kick := filepath.Join(src, "kick.wav")
+	writeFiles(t, kick,
+		filepath.Join(config.Output, "Drums", "kick.wav"),
+		filepath.Join(collect.PreviousPath(config.Output), "Drums", "kick.wav"),
+		filepath.Join(collect.StagingPath(config.Output), "Drums", "snare.wav"),
+	)
+	if _, paths := scanTree(t, src); len(paths) != 1 || paths[0] != kick {
+		t.Errorf("cataloged %v, want only %s", paths, kick)
+	}
+}
+
+func TestScanSymlinkLoop(t *testing.T) {
+	defer func(follow bool) { config.FollowSymlinks = follow }(config.FollowSymlinks)
+	config.FollowSymlinks = true
+	src := t.TempDir()
+	kick := filepath.Join(src, "a", "kick.wav")
+	writeFiles(t, kick)
+	for link, target := range map[string]string{"a/self": filepath.Join(src, "a"), "a/up": src} {
+		if err := os.Symlink(target, filepath.Join(src, filepath.FromSlash(link))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	s, paths := scanTree(t, src)
+	if len(paths) != 1 || paths[0] != kick {
+		t.Errorf("cataloged %v, want only %s", paths, kick)
+	}
+	// src and src/a, under the names first seen
+	if len(s.dirs) != 2 {
+		t.Errorf("walked %v, want each directory once", s.dirs)
+	}
+}
+
+func TestScanHardlinks(t *testing.T) {
+	src := t.TempDir()
+	kick := filepath.Join(src, "a", "kick.wav")
+	writeFiles(t, kick)
+	if err := os.MkdirAll(filepath.Join(src, "b"), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Link(kick, filepath.Join(src, "b", "kick_copy.wav")); err != nil {
+		t.Fatal(err)
+	}
+	if _, paths := scanTree(t, src); len(paths) != 1 || paths[0] != kick {
+		t.Errorf("cataloged %v, want only %s", paths, kick)
+	}
+}
@@ -0,0 +1,15 @@
+package main
+
+import (
+	"net/http"
+
+	"git.tcp.direct/kayos/keepr/internal/collect"
+	"git.tcp.direct/kayos/keepr/internal/config"
+	"git.tcp.direct/kayos/keepr/internal/serve"
+)
+
+// serveHTTP serves the web UI and API over collect.Library until killed.
+func serveHTTP() error {
+	log.Info().Str("url", "http://"+config.Listen+"/").Int("samples", len(collect.Library.Samples)).Msg("serving")
+	return http.ListenAndServe(config.Listen, serve.New(collect.Library))
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"io/fs"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"git.tcp.direct/kayos/keepr/internal/collect"
+	"git.tcp.direct/kayos/keepr/internal/config"
+	"git.tcp.direct/kayos/keepr/internal/filter"
+	"git.tcp.direct/kayos/keepr/internal/util"
+	"git.tcp.direct/kayos/keepr/internal/watch"
+)
+
+// watcher keeps collect.Library, the catalog and the link library in sync with the source roots.
+type watcher struct {
+	fsys    map[*config.SourceRoot]fs.FS
+	filters map[*config.SourceRoot]*filter.Filter
+}
+
+// watchSources catches up with whatever changed since the last scan, then follows changes until interrupted.
+// The link library is assumed to match the catalog, as link leaves it.
+func watchSources() error {
+	if err := load(); err != nil {
+		log.Warn().Err(err).Msg("no catalog yet, starting from scratch")
+	}
+	w := &watcher{
+		fsys:    make(map[*config.SourceRoot]fs.FS),
+		filters: make(map[*config.SourceRoot]*filter.Filter),
+	}
+	var roots []string
+	for _, root := range config.Sources {
+		w.fsys[root] = os.DirFS(root.Path)
+		filt, err := newFilter(root, w.fsys[root])
+		if err != nil {
+			return err
+		}
+		w.filters[root] = filt
+		roots = append(roots, root.Path)
+	}
+
+	iw, err := watch.New(w.skip)
+	if err != nil {
+		return err
+	}
+	defer iw.Close()
+	iw.Warn = func(err error) { log.Warn().Err(err).Msg("watch") }
+	for _, root := range roots {
+		before := iw.Watched()
+		if err = iw.Add(root); err != nil {
+			log.Warn().Str("path", root).Err(err).Msg("failed to watch everything")
+		}
+		if iw.Watched() == before {
+			log.Warn().Str("path", root).Msg("not watching anything under source root, changes to it will go unnoticed")
+		}
+	}
+
+	w.sync(roots)
+	log.Info().Int("directories", iw.Watched()).Dur("debounce", config.Debounce).Msg("watching for changes")
+
+	stop := make(chan struct{})
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-sigs
+		log.Info().Msg("stopping")
+		close(stop)
+	}()
+	return iw.Run(stop, config.Debounce, w.sync)
+}
+
+// rootOf finds the source root path is under, the innermost one if they nest.
+func (w *watcher) rootOf(path string) *config.SourceRoot {
+	var found *config.SourceRoot
+	for _, root := range config.Sources {
+		if collect.Under(path, root.Path) && (found == nil || len(root.Path) > len(found.Path)) {
+			found = root
+		}
+	}
+	return found
+}
+
+// skip applies the source root's filters, and keeps us out of our own output directories.
+func (w *watcher) skip(path string, isDir bool) bool {
+	root := w.rootOf(path)
+	if root == nil || underAny(path, outputDirs()) {
+		return true
+	}
+	rel, err := filepath.Rel(root.Path, path)
+	if err != nil {
+		return true
+	}
+	skip, _ := w.filters[root].Skip(filepath.ToSlash(rel), isDir)
+	return skip
+}
+
+// sync brings the library up to date with a batch of changed paths: samples that are gone or
+// changed are dropped, changed and new files processed, and only the affected links touched.
+func (w *watcher) sync(paths []string) {
+	var gone, dirs, files []string
+	for _, path := range paths {
+		fi, err := os.Stat(path)
+		switch {
+		case err != nil:
+			gone = append(gone, path)
+		case fi.IsDir():
+			dirs = append(dirs, path)
+		default:
+			files = append(files, path)
+		}
+	}
+	stale := func(s *collect.Sample) bool {
+		if underAny(s.Path, gone) {
+			return true
+		}
+		for _, path := range files {
+			if s.Path == path {
+				return true
+			}
+		}
+		for _, dir := range dirs {
+			if collect.Under(s.Path, dir) {
+				fi, err := os.Stat(s.Path)
+				return err != nil || !fi.ModTime().Equal(s.ModTime)
+			}
+		}
+		return false
+	}
+
+	old := collect.Library
+	next := old.Without(stale)
+	known := make(map[string]time.Time, len(next.Samples))
+	for _, s := range next.Samples {
+		known[s.Path] = s.ModTime
+	}
+	collect.Library = next
+
+	sc := newScanner()
+	sc.unchanged = func(path string, info fs.FileInfo) bool {
+		modTime, ok := known[path]
+		return ok && modTime.Equal(info.ModTime())
+	}
+	for _, path := range files {
+		root := w.rootOf(path)
+		if root == nil || w.skip(path, false) || underAny(path, dirs) {
+			// files in a changed directory are left to its walk
+			continue
+		}
+		fi, err := os.Stat(path)
+		if err != nil {
+			continue
+		}
+		if _, err = collect.Process(fs.FileInfoToDirEntry(fi), path, root.Label); err != nil {
+			log.Warn().Str("path", path).Err(err).Msg("failed to process")
+		}
+	}
+	for _, dir := range dirs {
+		root := w.rootOf(dir)
+		if root == nil || (dir != root.Path && w.skip(dir, true)) {
+			continue
+		}
+		rel, err := filepath.Rel(root.Path, dir)
+		if err != nil {
+			continue
+		}
+		sc.walk(root, w.fsys[root], w.filters[root], filepath.ToSlash(rel))
+	}
+	sc.process()
+	waitBacklog()
+
+	added, removed := collect.SyncLinks(old, next)
+	if len(config.Playlists) > 0 {
+		dir := util.APath(filepath.Join(config.Output, "Playlists"))
+		if _, err := next.WritePlaylists(dir, config.Playlists); err != nil {
+			log.Warn().Err(err).Msg("failed to write playlists")
+		}
+		collect.DropPlaylists(old, next, dir, config.Playlists)
+	}
+	waitBacklog()
+
+	if !config.Simulate {
+		if err := next.SaveCatalog(config.CatalogPath()); err != nil {
+			log.Error().Err(err).Msg("failed to save catalog")
+		}
+	}
+	log.Info().Int("changed", len(paths)).Int("samples", len(next.Samples)).
+		Int("linked", added).Int("unlinked", removed).Msg("synced")
+}
+
+func underAny(path string, dirs []string) bool {
+	for _, dir := range dirs {
+		if collect.Under(path, dir) {
+			return true
+		}
+	}
+	return false
+}
@@ -6,21 +6,22 @@ toolchain go1.24.1
 
 require (
 	git.tcp.direct/kayos/common v1.0.0
+	github.com/go-audio/audio v1.0.0
 	github.com/go-audio/wav v1.1.0
+	github.com/hanwen/go-fuse/v2 v2.9.0
 	github.com/mjibson/go-dsp v0.0.0-20180508042940-11479a337f12
 	github.com/rs/zerolog v1.34.0
+	golang.org/x/sys v0.28.0
 	gopkg.in/music-theory.v0 v0.0.4
+	gopkg.in/yaml.v2 v2.4.0
 	kr.dev/walk v0.1.0
 )
 
 require (
 	github.com/davecgh/go-spew v1.1.1 // indirect
-	github.com/go-audio/audio v1.0.0 // indirect
 	github.com/go-audio/riff v1.0.0 // indirect
 	github.com/mattn/go-colorable v0.1.13 // indirect
 	github.com/mattn/go-isatty v0.0.19 // indirect
 	github.com/pmezard/go-difflib v1.0.0 // indirect
-	golang.org/x/sys v0.22.0 // indirect
 	gopkg.in/stretchr/testify.v1 v1.2.2 // indirect
-	gopkg.in/yaml.v2 v2.4.0 // indirect
 )
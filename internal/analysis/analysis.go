@@ -1,5 +1,5 @@
-// Package analysis provides acoustic BPM and musical key detection
-// from raw PCM audio samples (mono float32, normalized to [-1,1]).
+// Package analysis provides acoustic BPM and musical key detection, and the peaks and spectra
+// behind waveform and spectrogram pictures, from raw PCM audio samples (mono float32, normalized to [-1,1]).
 //
 // started by yunginnanet/kayos. finished by lifelessai/ibot. kayos+ibot 5evr.
 package analysis
@@ -8,12 +8,17 @@ import (
 	"math"
 	"sort"
 
-	"github.com/mjibson/go-dsp/fft"
-	"github.com/mjibson/go-dsp/window"
 	"gopkg.in/music-theory.v0/key"
 )
 
 func DetectBPM(samples []float32, sampleRate int) float64 {
+	bpm, _ := DetectTempo(samples, sampleRate)
+	return bpm
+}
+
+// DetectTempo is DetectBPM that also returns how much the winning beat period stands out of the
+// others, from 0 (not at all) to 1.
+func DetectTempo(samples []float32, sampleRate int) (float64, float64) {
 	envelope := make([]float64, len(samples))
 	for i, s := range samples {
 		envelope[i] = math.Abs(float64(s))
@@ -54,9 +59,18 @@ func DetectBPM(samples []float32, sampleRate int) float64 {
 	}
 	lag := minLag + bestIdx
 	if lag == 0 {
-		return 0
+		return 0, 0
+	}
+	var mean float64
+	for _, v := range autocorr {
+		mean += v
 	}
-	return 60.0 * float64(newFs) / float64(lag)
+	mean /= float64(len(autocorr))
+	confidence := 0.0
+	if bestVal > 0 {
+		confidence = (bestVal - mean) / bestVal
+	}
+	return 60.0 * float64(newFs) / float64(lag), confidence
 }
 
 var (
@@ -136,14 +150,7 @@ func ComputeChroma(samples []float32, sampleRate int, maxSeconds float64) []floa
 	for pos := 0; pos+frameSize <= len(samples); pos += hopSize {
 		frame := make([]float64, frameSize)
 		for i := 0; i < frameSize; i++ { frame[i] = float64(samples[pos+i]) }
-		window.Apply(frame, window.Hann)
-		fftVals := fft.FFTReal(frame)
-		mag := make([]float64, frameSize/2+1)
-		for i := range mag {
-			re := real(fftVals[i])
-			im := imag(fftVals[i])
-			mag[i] = math.Sqrt(re*re + im*im)
-		}
+		mag := magnitudes(frame)
 		if !tuningEstimated {
 			tuningOffset = EstimateTuning(mag, binFreqs)
 			tuningEstimated = true
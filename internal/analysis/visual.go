@@ -0,0 +1,95 @@
+package analysis
+
+import (
+	"math"
+
+	"github.com/mjibson/go-dsp/fft"
+	"github.com/mjibson/go-dsp/window"
+)
+
+// magnitudes returns the magnitude spectrum of a frame, windowing it in place.
+func magnitudes(frame []float64) []float64 {
+	window.Apply(frame, window.Hann)
+	fftVals := fft.FFTReal(frame)
+	mag := make([]float64, len(frame)/2+1)
+	for i := range mag {
+		re, im := real(fftVals[i]), imag(fftVals[i])
+		mag[i] = math.Sqrt(re*re + im*im)
+	}
+	return mag
+}
+
+// Peaks splits samples into n buckets and returns the lowest and highest value of each,
+// interleaved: min, max, min, max... Fewer samples than buckets make fewer buckets.
+func Peaks(samples []float32, n int) []float32 {
+	if n > len(samples) {
+		n = len(samples)
+	}
+	peaks := make([]float32, 0, 2*n)
+	for i := 0; i < n; i++ {
+		bucket := samples[i*len(samples)/n : (i+1)*len(samples)/n]
+		lo, hi := bucket[0], bucket[0]
+		for _, v := range bucket[1:] {
+			if v < lo {
+				lo = v
+			}
+			if v > hi {
+				hi = v
+			}
+		}
+		peaks = append(peaks, lo, hi)
+	}
+	return peaks
+}
+
+// spectrogramFloor is the quietest level a spectrogram shows, in dB below its loudest bin.
+const spectrogramFloor = 80.0
+
+// Spectrogram returns columns frames evenly spread over samples, each with bands levels from 0 (silent)
+// to 1 (the loudest bin of the whole sample). Bands are spaced logarithmically from 30 Hz to Nyquist,
+// lowest first, the way people hear them.
+func Spectrogram(samples []float32, sampleRate, columns, bands int) [][]float64 {
+	const frameSize = 2048
+	nyquist := float64(sampleRate) / 2
+	lowest := math.Min(30, nyquist/2)
+	// band edges as FFT bins
+	edges := make([]int, bands+1)
+	for b := range edges {
+		freq := lowest * math.Pow(nyquist/lowest, float64(b)/float64(bands))
+		edges[b] = int(freq / nyquist * frameSize / 2)
+	}
+
+	spec := make([][]float64, columns)
+	loudest := math.Inf(-1)
+	for c := range spec {
+		frame := make([]float64, frameSize)
+		if len(samples) > frameSize {
+			pos := c * (len(samples) - frameSize) / max(columns-1, 1)
+			for i := range frame {
+				frame[i] = float64(samples[pos+i])
+			}
+		} else {
+			for i := range samples {
+				frame[i] = float64(samples[i])
+			}
+		}
+		mag := magnitudes(frame)
+		spec[c] = make([]float64, bands)
+		for b := 0; b < bands; b++ {
+			lo, hi := edges[b], max(edges[b+1], edges[b]+1)
+			var peak float64
+			for bin := lo; bin < hi && bin < len(mag); bin++ {
+				peak = math.Max(peak, mag[bin])
+			}
+			db := 20 * math.Log10(peak+1e-12)
+			spec[c][b] = db
+			loudest = math.Max(loudest, db)
+		}
+	}
+	for _, col := range spec {
+		for b, db := range col {
+			col[b] = math.Max(0, 1-(loudest-db)/spectrogramFloor)
+		}
+	}
+	return spec
+}
@@ -0,0 +1,62 @@
+package collect
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// catalogVersion is bumped whenever the on-disk catalog layout changes incompatibly.
+const catalogVersion = 1
+
+// catalog is the on-disk representation of a scanned Collection.
+type catalog struct {
+	Version int
+	Created time.Time
+	Samples []*Sample
+}
+
+// SaveCatalog writes every sample in the collection to path as JSON so that
+// later runs can link, query or export without walking the source again.
+func (c *Collection) SaveCatalog(path string) error {
+	c.mu.RLock()
+	cat := catalog{Version: catalogVersion, Created: time.Now(), Samples: c.Samples}
+	data, err := json.Marshal(cat)
+	c.mu.RUnlock()
+	if err != nil {
+		return fmt.Errorf("failed to encode catalog: %w", err)
+	}
+	if err = os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err = os.WriteFile(tmp, data, 0o644); err != nil {
+		return fmt.Errorf("failed to write catalog: %w", err)
+	}
+	return os.Rename(tmp, path)
+}
+
+// LoadCatalog reads a catalog written by SaveCatalog and ingests it into a new Collection.
+func LoadCatalog(path string) (*Collection, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read catalog (did you run scan?): %w", err)
+	}
+	var cat catalog
+	if err = json.Unmarshal(data, &cat); err != nil {
+		return nil, fmt.Errorf("failed to decode catalog %s: %w", path, err)
+	}
+	if cat.Version != catalogVersion {
+		return nil, fmt.Errorf("catalog %s is version %d, expected %d: please re-run scan", path, cat.Version, catalogVersion)
+	}
+	c := NewCollection()
+	for _, s := range cat.Samples {
+		if s.Types == nil {
+			s.Types = make(map[SampleType]struct{})
+		}
+		c.IngestSample(s)
+	}
+	return c, nil
+}
@@ -0,0 +1,63 @@
+package collect
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"gopkg.in/music-theory.v0/key"
+)
+
+func TestCatalog_RoundTrip(t *testing.T) {
+	c := newTestLibrary()
+	kick := &Sample{
+		Name:     "kick_01.wav",
+		Path:     "/samples/Kicks/kick_01.wav",
+		Duration: 300 * time.Millisecond,
+		Types:    map[SampleType]struct{}{TypeDrum: {}, TypeOneShot: {}},
+		DrumType: DrumKick,
+	}
+	loop := &Sample{
+		Name:  "pad_Amin_120.wav",
+		Path:  "/samples/Melodic/pad_Amin_120.wav",
+		Key:   key.Of("A minor"),
+		Tempo: 120,
+		Types: map[SampleType]struct{}{TypeMelodic: {}, TypeLoop: {}},
+	}
+	c.IngestSample(kick)
+	c.IngestSample(loop)
+
+	path := filepath.Join(t.TempDir(), "catalog.json")
+	if err := c.SaveCatalog(path); err != nil {
+		t.Fatalf("SaveCatalog() error = %v", err)
+	}
+	loaded, err := LoadCatalog(path)
+	if err != nil {
+		t.Fatalf("LoadCatalog() error = %v", err)
+	}
+
+	if len(loaded.Samples) != 2 {
+		t.Fatalf("loaded %d samples, want 2", len(loaded.Samples))
+	}
+	if got := len(loaded.Drums[DrumKick]); got != 1 {
+		t.Errorf("loaded %d kicks, want 1", got)
+	}
+	if got := len(loaded.Tempos[120]); got != 1 {
+		t.Errorf("loaded %d samples at 120BPM, want 1", got)
+	}
+	if got := len(loaded.Keys[key.Of("A minor")]); got != 1 {
+		t.Errorf("loaded %d samples in A minor, want 1", got)
+	}
+	if got := len(loaded.MelodicLoops); got != 1 {
+		t.Errorf("loaded %d melodic loops, want 1", got)
+	}
+	if !loaded.Samples[0].IsType(TypeOneShot) {
+		t.Errorf("sample types were not preserved: %v", loaded.Samples[0].Types)
+	}
+}
+
+func TestLoadCatalog_Missing(t *testing.T) {
+	if _, err := LoadCatalog(filepath.Join(t.TempDir(), "nope.json")); err == nil {
+		t.Error("LoadCatalog() on a missing file should fail")
+	}
+}
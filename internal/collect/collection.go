@@ -1,11 +1,14 @@
 package collect
 
 import (
+	"crypto/sha1"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
 	"strconv"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -14,18 +17,17 @@ import (
 	"github.com/rs/zerolog"
 	"gopkg.in/music-theory.v0/key"
 
+	"git.tcp.direct/kayos/keepr/internal/analysis"
 	"git.tcp.direct/kayos/keepr/internal/config"
+	"git.tcp.direct/kayos/keepr/internal/progress"
 	"git.tcp.direct/kayos/keepr/internal/util"
 )
 
 var log *zerolog.Logger
 
 func init() {
-	go func() {
-		for log == nil {
-			log = config.GetLogger()
-		}
-	}()
+	// config.GetLogger returns a stable pointer, KeeprInit replaces the logger it points to.
+	log = config.GetLogger()
 }
 
 // SampleType represents the type of sample we think it is.
@@ -43,6 +45,29 @@ const (
 	TypeMIDI
 )
 
+var typeNames = map[SampleType]string{
+	TypeUnknown: "unknown", TypeAmbient: "ambient", TypeMelodic: "melodic", TypeDrumLoop: "drumloop",
+	TypeOneShot: "oneshot", TypeDrum: "drum", TypeLoop: "loop", TypeMIDI: "midi",
+}
+
+func (t SampleType) String() string {
+	if name, ok := typeNames[t]; ok {
+		return name
+	}
+	return "unknown"
+}
+
+// ParseSampleType returns the SampleType matching name, as printed by SampleType.String.
+func ParseSampleType(name string) (SampleType, bool) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	for t, n := range typeNames {
+		if n == name {
+			return t, true
+		}
+	}
+	return TypeUnknown, false
+}
+
 type DrumType uint8
 
 const (
@@ -56,16 +81,110 @@ const (
 	Drum808
 )
 
+var drumNames = map[DrumType]string{
+	DrumKick: "kick", DrumSnare: "snare", DrumHiHat: "hihat", DrumHatClosed: "closedhat",
+	DrumHatOpen: "openhat", DrumTom: "tom", DrumPercussion: "percussion", Drum808: "808",
+}
+
+func (d DrumType) String() string {
+	if name, ok := drumNames[d]; ok {
+		return name
+	}
+	return "unknown"
+}
+
+// ParseDrumType returns the DrumType matching name, as printed by DrumType.String.
+func ParseDrumType(name string) (DrumType, bool) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	for d, n := range drumNames {
+		if n == name {
+			return d, true
+		}
+	}
+	return DrumKick, false
+}
+
 // Sample represents an audio sample and contains relevant information regarding said sample.
 type Sample struct {
-	Name     string
-	Path     string
-	ModTime  time.Time
+	Name    string
+	Path    string
+	ModTime time.Time
+	// Size and Fingerprint, see util.Fingerprint, identify the file should it move, see Relocate.
+	Size        int64
+	Fingerprint string
 	Duration time.Duration
 	Key      key.Key
-	Tempo    int
-	Types    map[SampleType]struct{}
+	// KeyCandidates are the best matches from key detection, strongest first, when it ran.
+	KeyCandidates []analysis.KeyGuess
+	// Chroma is how strongly each pitch class from C to B sounds, the strongest at 1, when key detection ran.
+	Chroma []float64
+	// KeySource tells where Key came from, one of the From* constants, empty when unknown.
+	KeySource string
+	Tempo     int
+	// TempoSource tells where Tempo came from, TempoCandidates are every tempo the filename, the audio
+	// and the MIDI tempo map suggested, in that order.
+	TempoSource     string
+	TempoCandidates []int
+	Types           map[SampleType]struct{}
+	DrumType        DrumType
+	// Root is the label of the source root the sample was found under.
+	Root     string
 	Metadata *wav.Metadata
+	// MIDI holds what we decoded from MIDI files, nil for everything else.
+	MIDI *MIDIInfo
+	// Progression is the chord progression of chord MIDI files.
+	Progression *Progression
+}
+
+// ID identifies the sample by its path, stable across runs as long as the file doesn't move.
+func (s *Sample) ID() string {
+	sum := sha1.Sum([]byte(s.Path))
+	return hex.EncodeToString(sum[:8])
+}
+
+// Phases of a run, logged as the phase field of what happens during them.
+const (
+	PhaseScan       = "scan"
+	PhaseAnalysis   = "analysis"
+	PhaseThumbnails = "thumbnails"
+	PhaseLink       = "link"
+)
+
+// Where a sample's key or tempo came from, logged as the source field of analysis results.
+const (
+	FromFilename     = "filename"
+	FromAudio        = "audio"
+	FromTempoMap     = "tempomap"
+	FromNotes        = "notes"
+	FromKeySignature = "keysig"
+)
+
+// normalizeChroma scales a chroma vector so that its strongest pitch class is 1, rounded for storage.
+func normalizeChroma(chroma []float64) []float64 {
+	var max float64
+	for _, v := range chroma {
+		if v > max {
+			max = v
+		}
+	}
+	if max == 0 {
+		return nil
+	}
+	norm := make([]float64, len(chroma))
+	for i, v := range chroma {
+		norm[i] = round2(v / max)
+	}
+	return norm
+}
+
+// appendTempo appends a tempo candidate unless it's already there.
+func appendTempo(tempos []int, tempo int) []int {
+	for _, t := range tempos {
+		if t == tempo {
+			return tempos
+		}
+	}
+	return append(tempos, tempo)
 }
 
 // TODO: make a "Collector" interface
@@ -81,25 +200,47 @@ type Collection struct {
 	CreationDates map[string][]*Sample
 	Arists        map[string][]*Sample
 	Software      map[string][]*Sample
+	Roots         map[string][]*Sample
 	DrumLoops     []*Sample
 	MelodicLoops  []*Sample
 	MIDIs         []*Sample
-	mu            *sync.RWMutex
+	// Samples holds every ingested sample in the order they were ingested.
+	Samples []*Sample
+	mu      *sync.RWMutex
+}
+
+// NewCollection returns an empty, ready to use Collection.
+func NewCollection() *Collection {
+	return &Collection{
+		Tempos:        make(map[int][]*Sample),
+		Keys:          make(map[key.Key][]*Sample),
+		Drums:         make(map[DrumType][]*Sample),
+		Artists:       make(map[string][]*Sample),
+		Sources:       make(map[string][]*Sample),
+		Genres:        make(map[string][]*Sample),
+		CreationDates: make(map[string][]*Sample),
+		Arists:        make(map[string][]*Sample),
+		Software:      make(map[string][]*Sample),
+		Roots:         make(map[string][]*Sample),
+
+		mu: &sync.RWMutex{},
+	}
 }
 
 // Library is a global default instance of a Collection.
-var Library = &Collection{
-	Tempos:        make(map[int][]*Sample),
-	Keys:          make(map[key.Key][]*Sample),
-	Drums:         make(map[DrumType][]*Sample),
-	Artists:       make(map[string][]*Sample),
-	Sources:       make(map[string][]*Sample),
-	Genres:        make(map[string][]*Sample),
-	CreationDates: make(map[string][]*Sample),
-	Arists:        make(map[string][]*Sample),
-	Software:      make(map[string][]*Sample),
+var Library = NewCollection()
 
-	mu: &sync.RWMutex{},
+// Filter returns every sample in the collection for which match returns true.
+func (c *Collection) Filter(match func(*Sample) bool) []*Sample {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	var res []*Sample
+	for _, s := range c.Samples {
+		if match(s) {
+			res = append(res, s)
+		}
+	}
+	return res
 }
 
 func (c *Collection) TypeStats() {
@@ -129,6 +270,15 @@ func (c *Collection) DrumStats() {
 	}
 }
 
+// RootStats outputs the amount of samples found under each source root.
+func (c *Collection) RootStats() {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	for t, ss := range c.Roots {
+		println(fmt.Sprintf("%s: %d", t, len(ss)))
+	}
+}
+
 // KeyStats outputs the amount of samples with each known key.
 func (c *Collection) KeyStats() {
 	c.mu.RLock()
@@ -140,9 +290,31 @@ func (c *Collection) KeyStats() {
 	}
 }
 
+// LinkInto links every sample into dir in the background, creating dir if needed. Callers wait on Backlog.
+func LinkInto(samples []*Sample, dir string) error {
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return err
+	}
+	for _, s := range samples {
+		spawnLink(s, dir)
+	}
+	return nil
+}
+
+// spawnLink links sample into kp in the background. Backlog is incremented before the
+// goroutine starts so that anyone waiting on it can't race ahead of the link.
+func spawnLink(sample *Sample, kp string) {
+	atomic.AddInt32(&Backlog, 1)
+	go func() {
+		defer atomic.AddInt32(&Backlog, -1)
+		link(sample, kp)
+	}()
+}
+
 func link(sample *Sample, kp string) {
 	atomic.AddInt32(&Backlog, 1)
 	defer atomic.AddInt32(&Backlog, -1)
+	defer progress.Add(0)
 
 	mapMu.RLock()
 	if _, ok := lockMap[sample.Path]; !ok {
@@ -157,23 +329,22 @@ func link(sample *Sample, kp string) {
 	lockMap[sample.Path].Lock()
 	defer lockMap[sample.Path].Unlock()
 
-	slog := log.With().Str("caller", sample.Path).Logger()
+	slog := log.With().Str("path", sample.Path).Str("phase", PhaseLink).Logger()
 	finalPath := filepath.Join(kp, sample.Name)
 	slog.Trace().Msg(finalPath)
-	err := util.FreshLink(finalPath)
-	if err != nil && !os.IsNotExist(err) {
-		slog.Warn().Msgf(err.Error())
-	}
-	if _, err = os.Stat(sample.Path); err != nil {
+	if _, err := os.Stat(sample.Path); err != nil {
 		slog.Warn().Err(err).Msg("can't stat original file")
 	}
 	if config.Simulate {
-		log.Printf("would have linked %s -> %s", sample.Path, finalPath)
+		log.Printf("would have linked %s -> %s (%s)", sample.Path, finalPath, config.LinkMode)
 		return
 	}
-	symerr := os.Symlink(sample.Path, finalPath)
-	if symerr != nil && !os.IsExist(symerr) && !os.IsNotExist(symerr) {
-		slog.Error().Err(symerr).Msg("failed to create symlink")
+	err := util.FreshLink(finalPath)
+	if err != nil && !os.IsNotExist(err) {
+		slog.Warn().Msgf(err.Error())
+	}
+	if _, err = place(sample.Path, finalPath); err != nil && !os.IsExist(err) {
+		slog.Error().Str("mode", config.LinkMode).Err(err).Msg("failed to link")
 	}
 }
 
@@ -187,7 +358,7 @@ func (c *Collection) SymlinkMelodicLoops() (err error) {
 	if len(c.MelodicLoops) < 1 {
 		return errors.New("no known melodic loops")
 	}
-	dst := util.APath(filepath.Join(config.Output, "Melodic Loops"), config.Relative)
+	dst := util.APath(filepath.Join(config.Output, "Melodic Loops"))
 	err = os.MkdirAll(dst, os.ModePerm)
 	mlpath := dst + "/"
 	if err != nil && !os.IsNotExist(err) {
@@ -203,7 +374,7 @@ func (c *Collection) SymlinkMelodicLoops() (err error) {
 		if _, ok := s.Types[TypeDrumLoop]; ok {
 			continue
 		}
-		go link(s, mlpath)
+		spawnLink(s, mlpath)
 	}
 	return nil
 }
@@ -218,7 +389,7 @@ func (c *Collection) SymlinkTempos() (err error) {
 	if len(c.Tempos) < 1 {
 		return errors.New("no known tempos")
 	}
-	dst := util.APath(filepath.Join(config.Output, "Tempo"), config.Relative)
+	dst := util.APath(filepath.Join(config.Output, "Tempo"))
 	err = os.MkdirAll(dst, os.ModePerm)
 	if err != nil && !os.IsNotExist(err) {
 		return
@@ -230,7 +401,7 @@ func (c *Collection) SymlinkTempos() (err error) {
 			return
 		}
 		for _, s := range ss {
-			go link(s, tempopath)
+			spawnLink(s, tempopath)
 		}
 	}
 	return nil
@@ -256,7 +427,7 @@ func (c *Collection) SymlinkKeys() (err error) {
 		return errors.New("no known keys")
 	}
 
-	dst := util.APath(filepath.Join(config.Output, "Key"), config.Relative)
+	dst := util.APath(filepath.Join(config.Output, "Key"))
 	err = os.MkdirAll(dst, os.ModePerm)
 	if err != nil && !os.IsNotExist(err) {
 		return
@@ -271,7 +442,7 @@ func (c *Collection) SymlinkKeys() (err error) {
 	samploop:
 		for _, s := range ss {
 			if _, ok := s.Types[TypeOneShot]; !ok {
-				go link(s, keypath)
+				spawnLink(s, keypath)
 				continue samploop
 			}
 			oskeypath := keypath + "OneShots/"
@@ -279,7 +450,7 @@ func (c *Collection) SymlinkKeys() (err error) {
 			if err != nil && !os.IsExist(err) {
 				return
 			}
-			go link(s, oskeypath)
+			spawnLink(s, oskeypath)
 		}
 	}
 	return nil
@@ -296,7 +467,7 @@ func (c *Collection) SymlinkDrums() (err error) {
 	if len(c.Drums) < 1 {
 		return errors.New("no known drums")
 	}
-	dst := util.APath(filepath.Join(config.Output, "Drums"), config.Relative)
+	dst := util.APath(filepath.Join(config.Output, "Drums"))
 	err = os.MkdirAll(dst, os.ModePerm)
 	if err != nil && !os.IsNotExist(err) {
 		return
@@ -308,7 +479,7 @@ func (c *Collection) SymlinkDrums() (err error) {
 			return
 		}
 		for _, s := range ss {
-			go link(s, drumpath)
+			spawnLink(s, drumpath)
 		}
 	}
 	return nil
@@ -324,33 +495,24 @@ func (c *Collection) SymlinkMIDIs() (err error) {
 	if len(c.MIDIs) < 1 {
 		return errors.New("no known MIDI")
 	}
-	dst := util.APath(filepath.Join(config.Output, "MIDI"), config.Relative)
+	dst := util.APath(filepath.Join(config.Output, "MIDI"))
 	if err = os.MkdirAll(dst, os.ModePerm); err != nil && !os.IsNotExist(err) {
 		return
 	}
+	// by key, tempo, what the notes are for, progression, time signature, length and instrument,
+	// and always MIDI/All for full browsability
+	var errs []error
 	for _, s := range c.MIDIs {
-		// Sort by key if known
-		if s.Key.Root != 0 {
-			keyName := s.Key.Root.String(s.Key.AdjSymbol) + modeStr(s.Key)
-			keyPath := filepath.Join(dst, "Key", keyName)
-			if mkErr := os.MkdirAll(keyPath, os.ModePerm); mkErr == nil {
-				go link(s, keyPath)
+		for _, dir := range midiViews(s) {
+			path := filepath.Join(dst, filepath.FromSlash(dir))
+			if mkErr := os.MkdirAll(path, os.ModePerm); mkErr != nil {
+				errs = append(errs, mkErr)
+				continue
 			}
-		}
-		// Sort by tempo if known
-		if s.Tempo > 0 {
-			tempoPath := filepath.Join(dst, "Tempo", strconv.Itoa(s.Tempo))
-			if mkErr := os.MkdirAll(tempoPath, os.ModePerm); mkErr == nil {
-				go link(s, tempoPath)
-			}
-		}
-		// Always also link to MIDI/All for full browsability
-		allPath := filepath.Join(dst, "All")
-		if mkErr := os.MkdirAll(allPath, os.ModePerm); mkErr == nil {
-			go link(s, allPath)
+			spawnLink(s, path)
 		}
 	}
-	return nil
+	return errors.Join(errs...)
 }
 
 func (c *Collection) SymlinkArtists() (err error) {
@@ -363,7 +525,7 @@ func (c *Collection) SymlinkArtists() (err error) {
 	if len(c.Artists) < 1 {
 		return errors.New("no known artists")
 	}
-	dst := util.APath(filepath.Join(config.Output, "Artists"), config.Relative)
+	dst := util.APath(filepath.Join(config.Output, "Artists"))
 	err = os.MkdirAll(dst, os.ModePerm)
 	if err != nil && !os.IsNotExist(err) {
 		return
@@ -375,7 +537,7 @@ func (c *Collection) SymlinkArtists() (err error) {
 			return
 		}
 		for _, s := range ss {
-			go link(s, artistpath)
+			spawnLink(s, artistpath)
 		}
 	}
 	return nil
@@ -391,7 +553,7 @@ func (c *Collection) SymlinkGenres() (err error) {
 	if len(c.Genres) < 1 {
 		return errors.New("no known genres")
 	}
-	dst := util.APath(filepath.Join(config.Output, "Genres"), config.Relative)
+	dst := util.APath(filepath.Join(config.Output, "Genres"))
 	err = os.MkdirAll(dst, os.ModePerm)
 	if err != nil && !os.IsNotExist(err) {
 		return
@@ -403,7 +565,7 @@ func (c *Collection) SymlinkGenres() (err error) {
 			return
 		}
 		for _, s := range ss {
-			go link(s, genrepath)
+			spawnLink(s, genrepath)
 		}
 	}
 	return nil
@@ -419,7 +581,8 @@ func (c *Collection) SymlinkSources() (err error) {
 	if len(c.Sources) < 1 {
 		return errors.New("no known sources")
 	}
-	dst := util.APath(filepath.Join(config.Output, "Sources"), config.Relative)
+	// "Sources" is taken by our source roots, see SymlinkRoots.
+	dst := util.APath(filepath.Join(config.Output, "Source Tags"))
 	err = os.MkdirAll(dst, os.ModePerm)
 	if err != nil && !os.IsNotExist(err) {
 		return
@@ -431,7 +594,36 @@ func (c *Collection) SymlinkSources() (err error) {
 			return
 		}
 		for _, s := range ss {
-			go link(s, sourcepath)
+			spawnLink(s, sourcepath)
+		}
+	}
+	return nil
+}
+
+// SymlinkRoots links samples by the label of the source root they were found under.
+func (c *Collection) SymlinkRoots() (err error) {
+	atomic.AddInt32(&Backlog, 1)
+	defer atomic.AddInt32(&Backlog, -1)
+	log.Trace().Msg("SymlinkRoots start")
+	defer log.Trace().Err(err).Msg("SymlinkRoots finish")
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if len(c.Roots) < 1 {
+		return errors.New("no known source roots")
+	}
+	dst := util.APath(filepath.Join(config.Output, "Sources"))
+	err = os.MkdirAll(dst, os.ModePerm)
+	if err != nil && !os.IsNotExist(err) {
+		return
+	}
+	for t, ss := range c.Roots {
+		rootpath := dst + "/" + t + "/"
+		err = os.MkdirAll(rootpath, os.ModePerm)
+		if err != nil && !os.IsExist(err) {
+			return
+		}
+		for _, s := range ss {
+			spawnLink(s, rootpath)
 		}
 	}
 	return nil
@@ -447,7 +639,7 @@ func (c *Collection) SymlinkCreationDates() (err error) {
 	if len(c.CreationDates) < 1 {
 		return errors.New("no known creation dates")
 	}
-	dst := util.APath(filepath.Join(config.Output, "Creation Dates"), config.Relative)
+	dst := util.APath(filepath.Join(config.Output, "Creation Dates"))
 	err = os.MkdirAll(dst, os.ModePerm)
 	if err != nil && !os.IsNotExist(err) {
 		return
@@ -459,7 +651,7 @@ func (c *Collection) SymlinkCreationDates() (err error) {
 			return
 		}
 		for _, s := range ss {
-			go link(s, creationpath)
+			spawnLink(s, creationpath)
 		}
 	}
 	return nil
@@ -475,7 +667,7 @@ func (c *Collection) SymlinkSoftwares() (err error) {
 	if len(c.Software) < 1 {
 		return errors.New("no known software")
 	}
-	dst := util.APath(filepath.Join(config.Output, "Software"), config.Relative)
+	dst := util.APath(filepath.Join(config.Output, "Software"))
 	err = os.MkdirAll(dst, os.ModePerm)
 	if err != nil && !os.IsNotExist(err) {
 		return
@@ -487,7 +679,7 @@ func (c *Collection) SymlinkSoftwares() (err error) {
 			return
 		}
 		for _, s := range ss {
-			go link(s, softwarepath)
+			spawnLink(s, softwarepath)
 		}
 	}
 	return nil
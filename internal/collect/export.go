@@ -0,0 +1,299 @@
+package collect
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/music-theory.v0/key"
+)
+
+// ExportSchema is the version of the Record layout. Fields may be added without bumping it,
+// renaming, removing or changing the meaning of one bumps it.
+const ExportSchema = 1
+
+// ExportFormats are the formats WriteRecords knows.
+var ExportFormats = []string{"json", "ndjson", "csv"}
+
+// Record is a sample as exported for other tools. Empty fields are left out of JSON and
+// left empty in CSV, list fields are joined with ";" in CSV.
+type Record struct {
+	Path string `json:"path"`
+	Name string `json:"name"`
+	// Source is the label of the source root the sample was found under.
+	Source string `json:"source,omitempty"`
+	// Modified is the file's modification time, RFC 3339.
+	Modified time.Time `json:"modified"`
+	// Types are the sample types, e.g. "loop" and "melodic", sorted.
+	Types []string `json:"types"`
+	// Drum is the drum type of drum samples, e.g. "kick".
+	Drum string `json:"drum,omitempty"`
+	// Duration is in seconds.
+	Duration float64 `json:"duration,omitempty"`
+	Tempo    int     `json:"tempo,omitempty"`
+	// TempoSource is where Tempo came from: filename, audio or tempomap.
+	TempoSource string `json:"tempo_source,omitempty"`
+	// TempoCandidates are every tempo the filename, the audio and the MIDI tempo map suggested, in that order.
+	TempoCandidates []int `json:"tempo_candidates,omitempty"`
+	// Key is e.g. "A minor".
+	Key string `json:"key,omitempty"`
+	// KeySource is where Key came from: filename, audio, notes or keysig.
+	KeySource string `json:"key_source,omitempty"`
+	// KeyCandidates are the best matches of key detection, strongest first.
+	KeyCandidates []KeyCandidate `json:"key_candidates,omitempty"`
+	// Chroma is how strongly each pitch class from C to B sounds, the strongest at 1.
+	Chroma []float64 `json:"chroma,omitempty"`
+	// Artist, Genre, Title, Software, SourceTag and Created come from WAV metadata.
+	Artist    string `json:"artist,omitempty"`
+	Genre     string `json:"genre,omitempty"`
+	Title     string `json:"title,omitempty"`
+	Software  string `json:"software,omitempty"`
+	SourceTag string `json:"source_tag,omitempty"`
+	Created   string `json:"created,omitempty"`
+	// MIDI is only set for MIDI files.
+	MIDI *MIDIRecord `json:"midi,omitempty"`
+	// Peaks is the waveform, only filled in on request and never written to CSV.
+	Peaks *Peaks `json:"peaks,omitempty"`
+	// Categories are the view directories the sample is linked into, relative to the output directory.
+	Categories []string `json:"categories"`
+}
+
+// KeyCandidate is a key detection match, Score is its correlation with the key profile.
+type KeyCandidate struct {
+	Key   string  `json:"key"`
+	Score float64 `json:"score"`
+}
+
+// MIDIRecord is the MIDI part of a Record, see MIDIInfo and NoteStats for what the fields mean.
+type MIDIRecord struct {
+	Kind          string   `json:"kind,omitempty"`
+	Format        int      `json:"format"`
+	Tracks        int      `json:"tracks"`
+	TimeSignature string   `json:"time_signature"`
+	Bars          int      `json:"bars"`
+	Beats         int      `json:"beats"`
+	TrackNames    []string `json:"track_names,omitempty"`
+	Instruments   []string `json:"instruments,omitempty"`
+	// Progression is e.g. "i-VI-III-VII", Chords the chords it's made of.
+	Progression  string   `json:"progression,omitempty"`
+	Chords       []string `json:"chords,omitempty"`
+	TempoInitial float64  `json:"tempo_initial,omitempty"`
+	TempoAverage float64  `json:"tempo_average,omitempty"`
+	TempoChanges int      `json:"tempo_changes"`
+	Notes        int      `json:"notes"`
+	Lowest       int      `json:"lowest"`
+	Highest      int      `json:"highest"`
+	Range        int      `json:"range"`
+	Density      float64  `json:"density"`
+	Velocity     float64  `json:"velocity"`
+	Swing        float64  `json:"swing"`
+	OffGrid      float64  `json:"offgrid"`
+	Polyphony    float64  `json:"polyphony"`
+	MaxPolyphony int      `json:"max_polyphony"`
+}
+
+// keyName names a key the way people write it, e.g. "F# minor".
+func keyName(k key.Key) string {
+	if k.Root == 0 {
+		return ""
+	}
+	name := k.Root.String(k.AdjSymbol)
+	if k.Mode == key.Major || k.Mode == key.Minor {
+		name += " " + strings.ToLower(k.Mode.String())
+	}
+	return name
+}
+
+// NewRecord builds the export Record of s, categories are its view directories, see Categories.
+func NewRecord(s *Sample, categories []string) Record {
+	r := Record{
+		Path: s.Path, Name: s.Name, Source: s.Root, Modified: s.ModTime,
+		Duration: s.Duration.Seconds(), Tempo: s.Tempo, TempoSource: s.TempoSource, TempoCandidates: s.TempoCandidates,
+		Key: keyName(s.Key), KeySource: s.KeySource, Chroma: s.Chroma,
+		Types: []string{}, Categories: categories,
+	}
+	if r.Categories == nil {
+		r.Categories = []string{}
+	}
+	for t := range s.Types {
+		r.Types = append(r.Types, t.String())
+	}
+	sort.Strings(r.Types)
+	if s.IsType(TypeDrum) || s.IsType(TypeDrumLoop) {
+		r.Drum = s.DrumType.String()
+	}
+	for _, c := range s.KeyCandidates {
+		r.KeyCandidates = append(r.KeyCandidates, KeyCandidate{Key: keyName(c.Key), Score: round2(c.Score)})
+	}
+	if md := s.Metadata; md != nil {
+		r.Artist, r.Genre, r.Title, r.Software = md.Artist, md.Genre, md.Title, md.Software
+		r.SourceTag, r.Created = md.Source, md.CreationDate
+	}
+	if mi := s.MIDI; mi != nil {
+		r.MIDI = &MIDIRecord{
+			Format: mi.Format, Tracks: mi.Tracks, TimeSignature: mi.TimeSignature, Bars: mi.Bars, Beats: mi.Beats,
+			TrackNames: mi.TrackNames, Instruments: mi.Instruments,
+			TempoInitial: mi.Tempo.Initial, TempoAverage: mi.Tempo.Average, TempoChanges: mi.Tempo.Changes,
+			Notes: mi.Notes.Count, Lowest: mi.Notes.Lowest, Highest: mi.Notes.Highest, Range: mi.Notes.Range,
+			Density: mi.Notes.Density, Velocity: mi.Notes.Velocity, Swing: mi.Notes.Swing, OffGrid: mi.Notes.OffGrid,
+			Polyphony: mi.Notes.Polyphony, MaxPolyphony: mi.Notes.MaxPolyphony,
+		}
+		if mi.Kind != MIDIUnknown {
+			r.MIDI.Kind = mi.Kind.String()
+		}
+		if s.Progression != nil {
+			r.MIDI.Progression = s.Progression.String()
+			r.MIDI.Chords = s.Progression.Chords
+		}
+	}
+	return r
+}
+
+// Records builds the export Records of samples, which must belong to c.
+func (c *Collection) Records(samples []*Sample) []Record {
+	categories := c.Categories()
+	records := make([]Record, 0, len(samples))
+	for _, s := range samples {
+		records = append(records, NewRecord(s, categories[s]))
+	}
+	return records
+}
+
+// csvColumns are the CSV columns in order, their names are the JSON names, MIDI ones prefixed with "midi_".
+var csvColumns = []struct {
+	name  string
+	value func(r *Record) string
+}{
+	{"path", func(r *Record) string { return r.Path }},
+	{"name", func(r *Record) string { return r.Name }},
+	{"source", func(r *Record) string { return r.Source }},
+	{"modified", func(r *Record) string { return r.Modified.Format(time.RFC3339) }},
+	{"types", func(r *Record) string { return strings.Join(r.Types, ";") }},
+	{"drum", func(r *Record) string { return r.Drum }},
+	{"duration", func(r *Record) string { return csvFloat(r.Duration) }},
+	{"tempo", func(r *Record) string { return csvInt(r.Tempo) }},
+	{"tempo_source", func(r *Record) string { return r.TempoSource }},
+	{"tempo_candidates", func(r *Record) string {
+		var tempos []string
+		for _, t := range r.TempoCandidates {
+			tempos = append(tempos, strconv.Itoa(t))
+		}
+		return strings.Join(tempos, ";")
+	}},
+	{"key", func(r *Record) string { return r.Key }},
+	{"key_source", func(r *Record) string { return r.KeySource }},
+	{"key_candidates", func(r *Record) string {
+		var keys []string
+		for _, c := range r.KeyCandidates {
+			keys = append(keys, c.Key+"="+csvFloat(c.Score))
+		}
+		return strings.Join(keys, ";")
+	}},
+	{"chroma", func(r *Record) string {
+		var chroma []string
+		for _, c := range r.Chroma {
+			chroma = append(chroma, strconv.FormatFloat(c, 'f', -1, 64))
+		}
+		return strings.Join(chroma, ";")
+	}},
+	{"artist", func(r *Record) string { return r.Artist }},
+	{"genre", func(r *Record) string { return r.Genre }},
+	{"title", func(r *Record) string { return r.Title }},
+	{"software", func(r *Record) string { return r.Software }},
+	{"source_tag", func(r *Record) string { return r.SourceTag }},
+	{"created", func(r *Record) string { return r.Created }},
+	{"midi_kind", midiColumn(func(m *MIDIRecord) string { return m.Kind })},
+	{"midi_format", midiColumn(func(m *MIDIRecord) string { return strconv.Itoa(m.Format) })},
+	{"midi_tracks", midiColumn(func(m *MIDIRecord) string { return strconv.Itoa(m.Tracks) })},
+	{"midi_time_signature", midiColumn(func(m *MIDIRecord) string { return m.TimeSignature })},
+	{"midi_bars", midiColumn(func(m *MIDIRecord) string { return strconv.Itoa(m.Bars) })},
+	{"midi_beats", midiColumn(func(m *MIDIRecord) string { return strconv.Itoa(m.Beats) })},
+	{"midi_track_names", midiColumn(func(m *MIDIRecord) string { return strings.Join(m.TrackNames, ";") })},
+	{"midi_instruments", midiColumn(func(m *MIDIRecord) string { return strings.Join(m.Instruments, ";") })},
+	{"midi_progression", midiColumn(func(m *MIDIRecord) string { return m.Progression })},
+	{"midi_chords", midiColumn(func(m *MIDIRecord) string { return strings.Join(m.Chords, ";") })},
+	{"midi_tempo_initial", midiColumn(func(m *MIDIRecord) string { return csvFloat(m.TempoInitial) })},
+	{"midi_tempo_average", midiColumn(func(m *MIDIRecord) string { return csvFloat(m.TempoAverage) })},
+	{"midi_tempo_changes", midiColumn(func(m *MIDIRecord) string { return strconv.Itoa(m.TempoChanges) })},
+	{"midi_notes", midiColumn(func(m *MIDIRecord) string { return strconv.Itoa(m.Notes) })},
+	{"midi_lowest", midiColumn(func(m *MIDIRecord) string { return strconv.Itoa(m.Lowest) })},
+	{"midi_highest", midiColumn(func(m *MIDIRecord) string { return strconv.Itoa(m.Highest) })},
+	{"midi_range", midiColumn(func(m *MIDIRecord) string { return strconv.Itoa(m.Range) })},
+	{"midi_density", midiColumn(func(m *MIDIRecord) string { return csvFloat(m.Density) })},
+	{"midi_velocity", midiColumn(func(m *MIDIRecord) string { return csvFloat(m.Velocity) })},
+	{"midi_swing", midiColumn(func(m *MIDIRecord) string { return csvFloat(m.Swing) })},
+	{"midi_offgrid", midiColumn(func(m *MIDIRecord) string { return csvFloat(m.OffGrid) })},
+	{"midi_polyphony", midiColumn(func(m *MIDIRecord) string { return csvFloat(m.Polyphony) })},
+	{"midi_max_polyphony", midiColumn(func(m *MIDIRecord) string { return strconv.Itoa(m.MaxPolyphony) })},
+	{"categories", func(r *Record) string { return strings.Join(r.Categories, ";") }},
+}
+
+func midiColumn(value func(m *MIDIRecord) string) func(r *Record) string {
+	return func(r *Record) string {
+		if r.MIDI == nil {
+			return ""
+		}
+		return value(r.MIDI)
+	}
+}
+
+func csvInt(i int) string {
+	if i == 0 {
+		return ""
+	}
+	return strconv.Itoa(i)
+}
+
+func csvFloat(f float64) string {
+	if f == 0 {
+		return ""
+	}
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
+
+// WriteRecords writes records to w in format, one of ExportFormats. JSON is an object holding
+// the schema version and the records, NDJSON is one record per line and CSV has a header row.
+func WriteRecords(w io.Writer, format string, records []Record) error {
+	switch format {
+	case "json":
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(struct {
+			Schema  int      `json:"schema"`
+			Samples []Record `json:"samples"`
+		}{ExportSchema, records})
+	case "ndjson":
+		enc := json.NewEncoder(w)
+		for i := range records {
+			if err := enc.Encode(&records[i]); err != nil {
+				return err
+			}
+		}
+		return nil
+	case "csv":
+		cw := csv.NewWriter(w)
+		row := make([]string, len(csvColumns))
+		for i, col := range csvColumns {
+			row[i] = col.name
+		}
+		if err := cw.Write(row); err != nil {
+			return err
+		}
+		for i := range records {
+			for j, col := range csvColumns {
+				row[j] = col.value(&records[i])
+			}
+			if err := cw.Write(row); err != nil {
+				return err
+			}
+		}
+		cw.Flush()
+		return cw.Error()
+	}
+	return fmt.Errorf("unknown export format %q, want one of %s", format, strings.Join(ExportFormats, ", "))
+}
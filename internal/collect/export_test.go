@@ -0,0 +1,127 @@
+package collect
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"gopkg.in/music-theory.v0/key"
+
+	"git.tcp.direct/kayos/keepr/internal/analysis"
+)
+
+func TestRecords(t *testing.T) {
+	c := NewCollection()
+	loop := &Sample{
+		Name: "synth_loop_120bpm_Am.wav", Path: "/src/synth_loop_120bpm_Am.wav", Root: "Splice",
+		Key: key.Of("Am"), KeySource: FromAudio, Tempo: 120, TempoSource: FromFilename, TempoCandidates: []int{120, 121},
+		KeyCandidates: []analysis.KeyGuess{{Key: key.Of("Am"), Score: 0.8123}, {Key: key.Of("C"), Score: 0.7}},
+		Duration:      4 * time.Second,
+		Types:         map[SampleType]struct{}{TypeMelodic: {}, TypeLoop: {}},
+	}
+	midi := &Sample{
+		Name: "chords.mid", Path: "/src/chords.mid", Key: key.Of("C"),
+		Types: map[SampleType]struct{}{TypeMIDI: {}},
+		MIDI:  &MIDIInfo{Kind: MIDIChords, TimeSignature: "4/4", Bars: 2},
+	}
+	c.IngestSample(loop)
+	c.IngestSample(midi)
+
+	records := c.Records([]*Sample{loop, midi})
+	r := records[0]
+	if r.Key != "A minor" || r.KeySource != "audio" || r.Tempo != 120 || r.TempoSource != "filename" {
+		t.Errorf("loop record = %+v", r)
+	}
+	if strings.Join(r.Types, ",") != "loop,melodic" {
+		t.Errorf("types = %v", r.Types)
+	}
+	if len(r.KeyCandidates) != 2 || r.KeyCandidates[0].Key != "A minor" || r.KeyCandidates[0].Score != 0.81 {
+		t.Errorf("key candidates = %v", r.KeyCandidates)
+	}
+	if want := "Key/A_Minor;Melodic Loops;Sources/Splice;Tempo/120"; strings.Join(r.Categories, ";") != want {
+		t.Errorf("categories = %v, want %s", r.Categories, want)
+	}
+	if m := records[1].MIDI; m == nil || m.Kind != "chords" || m.Bars != 2 {
+		t.Errorf("midi record = %+v", m)
+	}
+	if want := "Key/C_Major;MIDI/All;MIDI/Bars/2;MIDI/Chords;MIDI/Key/C_Major;MIDI/TimeSig/4-4"; strings.Join(records[1].Categories, ";") != want {
+		t.Errorf("categories = %v, want %s", records[1].Categories, want)
+	}
+
+	var buf bytes.Buffer
+	if err := WriteRecords(&buf, "json", records); err != nil {
+		t.Fatal(err)
+	}
+	var doc struct {
+		Schema  int
+		Samples []map[string]any
+	}
+	if err := json.Unmarshal(buf.Bytes(), &doc); err != nil {
+		t.Fatal(err)
+	}
+	if doc.Schema != ExportSchema || len(doc.Samples) != 2 || doc.Samples[0]["key"] != "A minor" {
+		t.Errorf("json = %s", buf.String())
+	}
+
+	buf.Reset()
+	if err := WriteRecords(&buf, "ndjson", records); err != nil {
+		t.Fatal(err)
+	}
+	if lines := strings.Split(strings.TrimSpace(buf.String()), "\n"); len(lines) != 2 {
+		t.Errorf("ndjson has %d lines, want 2", len(lines))
+	}
+
+	buf.Reset()
+	if err := WriteRecords(&buf, "csv", records); err != nil {
+		t.Fatal(err)
+	}
+	rows, err := csv.NewReader(&buf).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 3 || rows[0][0] != "path" || len(rows[1]) != len(csvColumns) {
+		t.Fatalf("csv = %v", rows)
+	}
+	col := func(name string) int {
+		for i, n := range rows[0] {
+			if n == name {
+				return i
+			}
+		}
+		t.Fatalf("no column %s", name)
+		return 0
+	}
+	if got := rows[1][col("tempo_candidates")]; got != "120;121" {
+		t.Errorf("tempo_candidates = %q", got)
+	}
+	if got := rows[2][col("midi_kind")]; got != "chords" {
+		t.Errorf("midi_kind = %q", got)
+	}
+	// every field json has, peaks aside
+	var fields []string
+	for _, typ := range []reflect.Type{reflect.TypeOf(Record{}), reflect.TypeOf(MIDIRecord{})} {
+		for i := 0; i < typ.NumField(); i++ {
+			name, _, _ := strings.Cut(typ.Field(i).Tag.Get("json"), ",")
+			if typ == reflect.TypeOf(MIDIRecord{}) {
+				name = "midi_" + name
+			}
+			if name != "peaks" && name != "midi" {
+				fields = append(fields, name)
+			}
+		}
+	}
+	if len(fields) != len(rows[0]) {
+		t.Errorf("csv has %d columns, json %d fields", len(rows[0]), len(fields))
+	}
+	for _, name := range fields {
+		col(name)
+	}
+
+	if err := WriteRecords(&buf, "xml", records); err == nil {
+		t.Error("unknown format should fail")
+	}
+}
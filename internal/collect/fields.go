@@ -0,0 +1,137 @@
+package collect
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// midiField wraps a MIDI only property, samples without MIDI info don't have it.
+func midiField(get func(*MIDIInfo) float64) func(*Sample) (float64, bool) {
+	return func(s *Sample) (float64, bool) {
+		if s.MIDI == nil {
+			return 0, false
+		}
+		return get(s.MIDI), true
+	}
+}
+
+// NumericFields are the sample properties usable for sorting and range filters, ok is false
+// when a sample doesn't have the property at all.
+var NumericFields = map[string]func(*Sample) (float64, bool){
+	"tempo": func(s *Sample) (float64, bool) { return float64(s.Tempo), s.Tempo > 0 },
+	"duration": func(s *Sample) (float64, bool) {
+		return s.Duration.Seconds(), s.Duration > 0
+	},
+	"bars":         midiField(func(mi *MIDIInfo) float64 { return float64(mi.WholeBars()) }),
+	"notes":        midiField(func(mi *MIDIInfo) float64 { return float64(mi.Notes.Count) }),
+	"lowest":       midiField(func(mi *MIDIInfo) float64 { return float64(mi.Notes.Lowest) }),
+	"highest":      midiField(func(mi *MIDIInfo) float64 { return float64(mi.Notes.Highest) }),
+	"range":        midiField(func(mi *MIDIInfo) float64 { return float64(mi.Notes.Range) }),
+	"density":      midiField(func(mi *MIDIInfo) float64 { return mi.Notes.Density }),
+	"velocity":     midiField(func(mi *MIDIInfo) float64 { return mi.Notes.Velocity }),
+	"swing":        midiField(func(mi *MIDIInfo) float64 { return mi.Notes.Swing }),
+	"offgrid":      midiField(func(mi *MIDIInfo) float64 { return mi.Notes.OffGrid }),
+	"polyphony":    midiField(func(mi *MIDIInfo) float64 { return mi.Notes.Polyphony }),
+	"maxpolyphony": midiField(func(mi *MIDIInfo) float64 { return float64(mi.Notes.MaxPolyphony) }),
+}
+
+// textFields sort alphabetically.
+var textFields = map[string]func(*Sample) string{
+	"name": func(s *Sample) string { return strings.ToLower(s.Name) },
+	"path": func(s *Sample) string { return s.Path },
+}
+
+// FieldNames lists every field SortSamples accepts, sorted.
+func FieldNames() []string {
+	var names []string
+	for name := range NumericFields {
+		names = append(names, name)
+	}
+	for name := range textFields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// SortSamples sorts samples by field, descending if field starts with "-".
+// Samples without the field go last either way.
+func SortSamples(samples []*Sample, field string) error {
+	desc := strings.HasPrefix(field, "-")
+	field = strings.ToLower(strings.TrimPrefix(field, "-"))
+	if text, ok := textFields[field]; ok {
+		sort.SliceStable(samples, func(i, j int) bool {
+			if desc {
+				return text(samples[i]) > text(samples[j])
+			}
+			return text(samples[i]) < text(samples[j])
+		})
+		return nil
+	}
+	get, ok := NumericFields[field]
+	if !ok {
+		return fmt.Errorf("unknown field %q, want one of %s", field, strings.Join(FieldNames(), ", "))
+	}
+	sort.SliceStable(samples, func(i, j int) bool {
+		a, aok := get(samples[i])
+		b, bok := get(samples[j])
+		switch {
+		case aok != bok:
+			return aok
+		case desc:
+			return a > b
+		default:
+			return a < b
+		}
+	})
+	return nil
+}
+
+// Range matches a numeric field between Min and Max, inclusive.
+type Range struct {
+	Field    string
+	Min, Max float64
+	get      func(*Sample) (float64, bool)
+}
+
+// ParseRange parses "field=N" for an exact value, "field=LO..HI" for a range and "field=LO.." or "field=..HI" for open
+// ended ones, as keepr query writes them. The older "field=LO-HI" is still understood.
+func ParseRange(spec string) (*Range, error) {
+	field, bounds, ok := strings.Cut(spec, "=")
+	field = strings.ToLower(strings.TrimSpace(field))
+	if !ok || bounds == "" {
+		return nil, fmt.Errorf("bad range %q, want FIELD=LO..HI", spec)
+	}
+	get, known := NumericFields[field]
+	if !known {
+		return nil, fmt.Errorf("unknown field %q in %q", field, spec)
+	}
+	r := &Range{Field: field, get: get, Min: -1 << 62, Max: 1 << 62}
+	lo, hi, isRange := strings.Cut(bounds, "..")
+	if !isRange {
+		lo, hi, isRange = strings.Cut(bounds, "-")
+	}
+	if !isRange {
+		hi = lo
+	}
+	var err error
+	if lo = strings.TrimSpace(lo); lo != "" {
+		if r.Min, err = strconv.ParseFloat(lo, 64); err != nil {
+			return nil, fmt.Errorf("bad lower bound in %q: %w", spec, err)
+		}
+	}
+	if hi = strings.TrimSpace(hi); hi != "" {
+		if r.Max, err = strconv.ParseFloat(hi, 64); err != nil {
+			return nil, fmt.Errorf("bad upper bound in %q: %w", spec, err)
+		}
+	}
+	return r, nil
+}
+
+// Match reports whether s has the field and it's within the range.
+func (r *Range) Match(s *Sample) bool {
+	v, ok := r.get(s)
+	return ok && v >= r.Min && v <= r.Max
+}
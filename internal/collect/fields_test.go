@@ -0,0 +1,71 @@
+package collect
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseRange(t *testing.T) {
+	fast := &Sample{Tempo: 140}
+	slow := &Sample{Tempo: 80}
+	none := &Sample{}
+	tests := []struct {
+		spec string
+		want []bool
+	}{
+		{"tempo=140", []bool{true, false, false}},
+		{"tempo=100-150", []bool{true, false, false}},
+		{"tempo=-100", []bool{false, true, false}},
+		{"tempo=80-", []bool{true, true, false}},
+		{"TEMPO=0-", []bool{true, true, false}},
+		{"tempo=100..150", []bool{true, false, false}},
+		{"tempo=..100", []bool{false, true, false}},
+		{"tempo=80..", []bool{true, true, false}},
+	}
+	for _, tt := range tests {
+		r, err := ParseRange(tt.spec)
+		if err != nil {
+			t.Fatalf("ParseRange(%q): %v", tt.spec, err)
+		}
+		for i, s := range []*Sample{fast, slow, none} {
+			if got := r.Match(s); got != tt.want[i] {
+				t.Errorf("%q matches tempo %d = %v, want %v", tt.spec, s.Tempo, got, tt.want[i])
+			}
+		}
+	}
+	for _, bad := range []string{"tempo", "tempo=", "bogus=1", "tempo=fast", "tempo=1-x", "tempo=1..x", "tempo=1x..2y", "tempo=90bpm"} {
+		if _, err := ParseRange(bad); err == nil {
+			t.Errorf("ParseRange(%q) should fail", bad)
+		}
+	}
+}
+
+func TestSortSamples(t *testing.T) {
+	a := &Sample{Name: "a", Duration: 2 * time.Second, MIDI: &MIDIInfo{Notes: NoteStats{Density: 4}}}
+	b := &Sample{Name: "B", Duration: time.Second, MIDI: &MIDIInfo{Notes: NoteStats{Density: 12}}}
+	c := &Sample{Name: "c"}
+	tests := []struct {
+		field string
+		want  []*Sample
+	}{
+		{"name", []*Sample{a, b, c}},
+		{"-name", []*Sample{c, b, a}},
+		{"duration", []*Sample{b, a, c}},
+		{"density", []*Sample{a, b, c}},
+		{"-density", []*Sample{b, a, c}},
+	}
+	for _, tt := range tests {
+		samples := []*Sample{c, a, b}
+		if err := SortSamples(samples, tt.field); err != nil {
+			t.Fatal(err)
+		}
+		for i := range samples {
+			if samples[i] != tt.want[i] {
+				t.Errorf("SortSamples(%q) put %s at %d, want %s", tt.field, samples[i].Name, i, tt.want[i].Name)
+			}
+		}
+	}
+	if err := SortSamples(nil, "bogus"); err == nil {
+		t.Error("SortSamples should reject unknown fields")
+	}
+}
@@ -0,0 +1,121 @@
+package collect
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"git.tcp.direct/kayos/keepr/internal/util"
+)
+
+// StagingPath is where an atomic link builds the next generation of the output tree at output. It is
+// next to output, so that it is on the same filesystem and relative links come out the same.
+func StagingPath(output string) string {
+	return sibling(output, "staging")
+}
+
+// PreviousPath is where the generation of the output tree at output that was last swapped out is kept.
+func PreviousPath(output string) string {
+	return sibling(output, "previous")
+}
+
+// Generations are the output tree at output and the generations of it an atomic link keeps next to
+// it, none of which are source material.
+func Generations(output string) []string {
+	return []string{output, StagingPath(output), PreviousPath(output)}
+}
+
+func sibling(output, what string) string {
+	output = filepath.Clean(output)
+	return filepath.Join(filepath.Dir(output), "."+filepath.Base(output)+".keepr-"+what)
+}
+
+// Stage creates an empty staging directory for output, clearing out whatever a failed run left there.
+func Stage(output string) (string, error) {
+	staging := StagingPath(output)
+	if err := os.RemoveAll(staging); err != nil {
+		return "", err
+	}
+	return staging, os.Mkdir(staging, os.ModePerm)
+}
+
+// Swap replaces the output tree at output with the one built at staging, keeping the replaced one at
+// PreviousPath for Rollback. The state directory, config file and playlists come along unless
+// staging has its own.
+func Swap(output, staging string) error {
+	if _, err := os.Lstat(output); os.IsNotExist(err) {
+		return os.Rename(staging, output)
+	}
+	previous := PreviousPath(output)
+	if err := os.RemoveAll(previous); err != nil {
+		return err
+	}
+	return swap(output, staging, previous)
+}
+
+// Rollback swaps the previous generation of the output tree at output back in, and the current one
+// out in its place, so that rolling back twice undoes the first.
+func Rollback(output string) error {
+	previous := PreviousPath(output)
+	if _, err := os.Stat(previous); err != nil {
+		if os.IsNotExist(err) {
+			return errors.New("there is no previous generation to roll back to")
+		}
+		return err
+	}
+	return swap(output, previous, previous)
+}
+
+// swap puts next in output's place and what was at output at previous, which must not exist unless
+// it is next.
+func swap(output, next, previous string) error {
+	carried, err := carry(output, next)
+	if err != nil {
+		return err
+	}
+	err = util.Exchange(next, output)
+	switch {
+	case err == nil:
+		if next != previous {
+			err = os.Rename(next, previous)
+		}
+		return err
+	case errors.Is(err, util.ErrNoExchange):
+		log.Warn().Str("path", output).Msg("can't swap atomically here, the library will be gone for a moment")
+		old := sibling(output, "old")
+		if err = os.Rename(output, old); err != nil {
+			break
+		}
+		if err = os.Rename(next, output); err != nil {
+			_ = os.Rename(old, output)
+			break
+		}
+		return os.Rename(old, previous)
+	}
+	for _, name := range carried {
+		_ = os.Rename(filepath.Join(next, name), filepath.Join(output, name))
+	}
+	return fmt.Errorf("failed to swap in %s: %w", next, err)
+}
+
+// carry moves the entries of outputExtras from the tree at from to the one at to, where to lacks them.
+func carry(from, to string) ([]string, error) {
+	var carried []string
+	for name := range outputExtras {
+		if _, err := os.Lstat(filepath.Join(to, name)); err == nil {
+			continue
+		}
+		if _, err := os.Lstat(filepath.Join(from, name)); err != nil {
+			continue
+		}
+		if err := os.Rename(filepath.Join(from, name), filepath.Join(to, name)); err != nil {
+			for _, done := range carried {
+				_ = os.Rename(filepath.Join(to, done), filepath.Join(from, done))
+			}
+			return nil, err
+		}
+		carried = append(carried, name)
+	}
+	return carried, nil
+}
@@ -0,0 +1,57 @@
+package collect
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"git.tcp.direct/kayos/keepr/internal/config"
+)
+
+func TestSwapAndRollback(t *testing.T) {
+	output := filepath.Join(t.TempDir(), "library")
+	write := func(path string) {
+		if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	exists := func(path string) bool {
+		_, err := os.Lstat(path)
+		return err == nil
+	}
+	write(filepath.Join(output, "Key", "A_Minor", "old.wav"))
+	write(filepath.Join(output, config.StateDir, "catalog.json"))
+
+	staging, err := Stage(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	write(filepath.Join(staging, "Key", "C_Major", "new.wav"))
+	if err = Swap(output, staging); err != nil {
+		t.Fatal(err)
+	}
+	previous := PreviousPath(output)
+	switch {
+	case !exists(filepath.Join(output, "Key", "C_Major", "new.wav")) || exists(filepath.Join(output, "Key", "A_Minor")):
+		t.Error("new generation wasn't swapped in")
+	case !exists(filepath.Join(output, config.StateDir, "catalog.json")):
+		t.Error("state wasn't carried over")
+	case !exists(filepath.Join(previous, "Key", "A_Minor", "old.wav")):
+		t.Error("previous generation wasn't kept")
+	case exists(staging):
+		t.Error("staging directory left behind")
+	}
+
+	if err = Rollback(output); err != nil {
+		t.Fatal(err)
+	}
+	if !exists(filepath.Join(output, "Key", "A_Minor", "old.wav")) || !exists(filepath.Join(output, config.StateDir, "catalog.json")) {
+		t.Error("rollback didn't restore the previous generation with the current state")
+	}
+	if err = Rollback(output); err != nil || !exists(filepath.Join(output, "Key", "C_Major", "new.wav")) {
+		t.Errorf("rolling back twice didn't undo the first: %v", err)
+	}
+}
@@ -14,7 +14,7 @@ func (c *Collection) IngestKey(sample *Sample) {
 	}
 	atomic.AddInt32(&Backlog, 1)
 	defer atomic.AddInt32(&Backlog, -1)
-	log.Debug().Str("caller", sample.Name).Msgf("Key: %s", sample.Key.Root.String(sample.Key.AdjSymbol)+modeStr(sample.Key))
+	log.Debug().Str("path", sample.Path).Str("attribute", "key").Str("source", sample.KeySource).Msgf("Key: %s", sample.Key.Root.String(sample.Key.AdjSymbol)+modeStr(sample.Key))
 	c.mu.Lock()
 	c.Keys[sample.Key] = append(c.Keys[sample.Key], sample)
 	c.mu.Unlock()
@@ -28,7 +28,7 @@ func (c *Collection) IngestTempo(sample *Sample) {
 	atomic.AddInt32(&Backlog, 1)
 	defer atomic.AddInt32(&Backlog, -1)
 	c.mu.Lock()
-	log.Debug().Str("caller", sample.Name).Msgf("Tempo: %d", sample.Tempo)
+	log.Debug().Str("path", sample.Path).Str("attribute", "tempo").Str("source", sample.TempoSource).Msgf("Tempo: %d", sample.Tempo)
 	c.Tempos[sample.Tempo] = append(c.Tempos[sample.Tempo], sample)
 	c.mu.Unlock()
 }
@@ -40,7 +40,7 @@ func (c *Collection) IngestMelodicLoop(sample *Sample) {
 	}
 	atomic.AddInt32(&Backlog, 1)
 	defer atomic.AddInt32(&Backlog, -1)
-	log.Debug().Str("caller", sample.Name).Msg("Melodic Loop")
+	log.Debug().Str("path", sample.Path).Msg("Melodic Loop")
 	c.mu.Lock()
 	c.MelodicLoops = append(c.MelodicLoops, sample)
 	c.mu.Unlock()
@@ -53,7 +53,7 @@ func (c *Collection) IngestMIDI(sample *Sample) {
 	}
 	atomic.AddInt32(&Backlog, 1)
 	defer atomic.AddInt32(&Backlog, -1)
-	log.Debug().Str("caller", sample.Name).Msg("MIDI")
+	log.Debug().Str("path", sample.Path).Msg("MIDI")
 	c.mu.Lock()
 	c.MIDIs = append(c.MIDIs, sample)
 	c.mu.Unlock()
@@ -66,7 +66,7 @@ func (c *Collection) IngestDrum(sample *Sample, drumType DrumType) {
 	}
 	atomic.AddInt32(&Backlog, 1)
 	defer atomic.AddInt32(&Backlog, -1)
-	log.Debug().Str("caller", sample.Name).Msgf("Drum: %s", drumToDirMap[drumType])
+	log.Debug().Str("path", sample.Path).Str("attribute", "drum").Msgf("Drum: %s", drumToDirMap[drumType])
 	c.mu.Lock()
 	c.Drums[drumType] = append(c.Drums[drumType], sample)
 	c.mu.Unlock()
@@ -78,7 +78,7 @@ func (c *Collection) IngestArtist(sample *Sample) {
 	}
 	atomic.AddInt32(&Backlog, 1)
 	defer atomic.AddInt32(&Backlog, -1)
-	log.Debug().Str("caller", sample.Name).Msgf("Artist: %s", sample.Metadata.Artist)
+	log.Debug().Str("path", sample.Path).Str("attribute", "artist").Msgf("Artist: %s", sample.Metadata.Artist)
 	c.mu.Lock()
 	c.Artists[sample.Metadata.Artist] = append(c.Artists[sample.Metadata.Artist], sample)
 	c.mu.Unlock()
@@ -90,7 +90,7 @@ func (c *Collection) IngestGenre(sample *Sample) {
 	}
 	atomic.AddInt32(&Backlog, 1)
 	defer atomic.AddInt32(&Backlog, -1)
-	log.Debug().Str("caller", sample.Name).Msgf("Genre: %s", sample.Metadata.Genre)
+	log.Debug().Str("path", sample.Path).Str("attribute", "genre").Msgf("Genre: %s", sample.Metadata.Genre)
 	c.mu.Lock()
 	c.Genres[sample.Metadata.Genre] = append(c.Genres[sample.Metadata.Genre], sample)
 	c.mu.Unlock()
@@ -102,19 +102,32 @@ func (c *Collection) IngestSource(sample *Sample) {
 	}
 	atomic.AddInt32(&Backlog, 1)
 	defer atomic.AddInt32(&Backlog, -1)
-	log.Debug().Str("caller", sample.Name).Msgf("Source: %s", sample.Metadata.Source)
+	log.Debug().Str("path", sample.Path).Str("attribute", "source tag").Msgf("Source: %s", sample.Metadata.Source)
 	c.mu.Lock()
 	c.Sources[sample.Metadata.Source] = append(c.Sources[sample.Metadata.Source], sample)
 	c.mu.Unlock()
 }
 
+// IngestRoot creates a map of source root labels to samples.
+func (c *Collection) IngestRoot(sample *Sample) {
+	if sample.Root == "" {
+		return
+	}
+	atomic.AddInt32(&Backlog, 1)
+	defer atomic.AddInt32(&Backlog, -1)
+	log.Debug().Str("path", sample.Path).Str("attribute", "root").Msgf("Root: %s", sample.Root)
+	c.mu.Lock()
+	c.Roots[sample.Root] = append(c.Roots[sample.Root], sample)
+	c.mu.Unlock()
+}
+
 func (c *Collection) IngestCreationDate(sample *Sample) {
 	if sample.Metadata == nil || sample.Metadata.CreationDate == "" {
 		return
 	}
 	atomic.AddInt32(&Backlog, 1)
 	defer atomic.AddInt32(&Backlog, -1)
-	log.Debug().Str("caller", sample.Name).Msgf("Creation Date: %s", sample.Metadata.CreationDate)
+	log.Debug().Str("path", sample.Path).Str("attribute", "creation date").Msgf("Creation Date: %s", sample.Metadata.CreationDate)
 	c.mu.Lock()
 	c.CreationDates[sample.Metadata.CreationDate] = append(c.CreationDates[sample.Metadata.CreationDate], sample)
 	c.mu.Unlock()
@@ -126,7 +139,7 @@ func (c *Collection) IngestSoftware(sample *Sample) {
 	}
 	atomic.AddInt32(&Backlog, 1)
 	defer atomic.AddInt32(&Backlog, -1)
-	log.Debug().Str("caller", sample.Name).Msgf("Software: %s", sample.Metadata.Software)
+	log.Debug().Str("path", sample.Path).Str("attribute", "software").Msgf("Software: %s", sample.Metadata.Software)
 	c.mu.Lock()
 	c.Software[sample.Metadata.Software] = append(c.Software[sample.Metadata.Software], sample)
 	c.mu.Unlock()
@@ -153,10 +166,14 @@ var replacers = []string{
 }
 
 func (c *Collection) IngestSample(sample *Sample) {
+	c.mu.Lock()
+	c.Samples = append(c.Samples, sample)
+	c.mu.Unlock()
 	c.IngestMetadata(sample)
+	c.IngestRoot(sample)
 	c.IngestKey(sample)
 	c.IngestTempo(sample)
-	// c.IngestDrum(sample, sample.DrumType) // happens during filename parsing
+	c.IngestDrum(sample, sample.DrumType)
 	c.IngestMelodicLoop(sample)
 	c.IngestMIDI(sample)
 	c.DeDupe()
@@ -0,0 +1,121 @@
+package collect
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+
+	"git.tcp.direct/kayos/keepr/internal/config"
+	"git.tcp.direct/kayos/keepr/internal/util"
+)
+
+// Link modes, see config.LinkMode.
+const (
+	LinkSymlink  = "symlink"
+	LinkHardlink = "hardlink"
+	LinkReflink  = "reflink"
+	LinkCopy     = "copy"
+)
+
+// fallbacks are the modes tried for each link mode, in order, until one works for the file at hand.
+// Copying is the only mode that costs disk space, so nothing falls back to it. Reflinks don't fall
+// back to hardlinks either: edits made in the view would write through to the original.
+var fallbacks = map[string][]string{
+	LinkSymlink:  {LinkSymlink},
+	LinkHardlink: {LinkHardlink, LinkSymlink},
+	LinkReflink:  {LinkReflink, LinkSymlink},
+	LinkCopy:     {LinkCopy},
+}
+
+var (
+	fellBackMu sync.Mutex
+	fellBack   = make(map[string]int)
+)
+
+// FellBack returns how many files were placed with each mode other than config.LinkMode since it was
+// last called, because config.LinkMode wasn't possible for them, and forgets about them.
+func FellBack() map[string]int {
+	fellBackMu.Lock()
+	defer fellBackMu.Unlock()
+	counts := fellBack
+	fellBack = make(map[string]int)
+	return counts
+}
+
+// place puts the file at src into a view at dst, which must not exist, the way config.LinkMode says,
+// falling back to the next mode that works when it can't. It returns the mode used.
+func place(src, dst string) (string, error) {
+	modes, ok := fallbacks[config.LinkMode]
+	if !ok {
+		modes = fallbacks[LinkSymlink]
+	}
+	var reasons []string
+	for _, mode := range modes {
+		err := placeAs(mode, src, dst)
+		if err == nil {
+			if mode != modes[0] {
+				log.Warn().Str("path", dst).Str("wanted", modes[0]).Str("used", mode).
+					Str("reason", strings.Join(reasons, "; ")).Msgf("link mode not possible, fell back to %s", mode)
+				fellBackMu.Lock()
+				fellBack[mode]++
+				fellBackMu.Unlock()
+			}
+			return mode, nil
+		}
+		if errors.Is(err, os.ErrNotExist) {
+			// no mode can do anything about a missing file
+			return "", err
+		}
+		reasons = append(reasons, mode+": "+err.Error())
+	}
+	return "", errors.New(strings.Join(reasons, "; "))
+}
+
+func placeAs(mode, src, dst string) error {
+	if mode == LinkSymlink {
+		target, err := util.LinkTarget(src, dst, config.Relative)
+		if err != nil {
+			log.Warn().Str("path", src).Err(err).Msg("falling back to absolute link")
+		}
+		return os.Symlink(target, dst)
+	}
+	// the others would link or copy a symlink itself rather than what it points at
+	real, err := filepath.EvalSymlinks(src)
+	if err != nil {
+		return err
+	}
+	switch mode {
+	case LinkHardlink:
+		if err = os.Link(real, dst); errors.Is(err, syscall.EXDEV) {
+			return errors.New("source and output are on different filesystems")
+		}
+		return err
+	case LinkReflink:
+		return util.Reflink(real, dst)
+	case LinkCopy:
+		return util.CopyFile(real, dst)
+	}
+	return errors.New("unknown link mode " + mode)
+}
+
+// ReportFallbacks logs a summary of FellBack, if anything fell back.
+func ReportFallbacks() {
+	counts := FellBack()
+	if len(counts) == 0 {
+		return
+	}
+	modes := make([]string, 0, len(counts))
+	for mode := range counts {
+		modes = append(modes, mode)
+	}
+	sort.Strings(modes)
+	ev := log.Warn().Str("wanted", config.LinkMode)
+	for _, mode := range modes {
+		ev = ev.Int(mode, counts[mode])
+	}
+	ev.Msg("some files couldn't be linked as wanted, see the warnings above")
+}
@@ -0,0 +1,64 @@
+package collect
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"git.tcp.direct/kayos/keepr/internal/config"
+)
+
+func TestPlace(t *testing.T) {
+	defer func(mode string) { config.LinkMode = mode }(config.LinkMode)
+	dir := t.TempDir()
+	src := filepath.Join(dir, "kick.wav")
+	if err := os.WriteFile(src, []byte("RIFF"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	srcInfo, _ := os.Stat(src)
+	FellBack()
+
+	for _, mode := range []string{LinkSymlink, LinkHardlink, LinkReflink, LinkCopy} {
+		config.LinkMode = mode
+		dst := filepath.Join(dir, mode+".wav")
+		used, err := place(src, dst)
+		if err != nil {
+			t.Fatalf("%s: %v", mode, err)
+		}
+		fi, err := os.Lstat(dst)
+		if err != nil {
+			t.Fatal(err)
+		}
+		switch used {
+		case LinkSymlink:
+			if fi.Mode()&os.ModeSymlink == 0 {
+				t.Errorf("%s: not a symlink", mode)
+			}
+		case LinkHardlink:
+			if !os.SameFile(fi, srcInfo) {
+				t.Errorf("%s: not a hardlink", mode)
+			}
+		default:
+			if !fi.Mode().IsRegular() || os.SameFile(fi, srcInfo) {
+				t.Errorf("%s: not a file of its own", mode)
+			}
+		}
+		if data, _ := os.ReadFile(dst); string(data) != "RIFF" {
+			t.Errorf("%s: reads %q", mode, data)
+		}
+		if mode == LinkReflink && used != LinkReflink {
+			// most test machines don't have btrfs or xfs
+			if counts := FellBack(); used != LinkSymlink || counts[used] != 1 {
+				t.Errorf("reflink fell back to %s, counted %v", used, counts)
+			}
+		} else if used != mode {
+			t.Errorf("%s: used %s", mode, used)
+		}
+		if !unlink(dst) {
+			t.Errorf("%s: unlink failed", mode)
+		}
+	}
+	if _, err := os.Stat(src); err != nil {
+		t.Errorf("original is gone: %v", err)
+	}
+}
@@ -2,121 +2,543 @@ package collect
 
 import (
 	"encoding/binary"
+	"errors"
+	"fmt"
 	"io"
+	"math"
 	"os"
+	"sort"
+	"strings"
+	"time"
 
 	"gopkg.in/music-theory.v0/key"
+
+	"git.tcp.direct/kayos/keepr/internal/analysis"
 )
 
-// parseMIDI reads tempo (BPM) and key signature from a MIDI file's meta events.
+// midiDrumChannel is channel 10 in General MIDI, zero indexed. Its notes are drum
+// sounds rather than pitches, so they're left out of key detection.
+const midiDrumChannel = 9
+
+// midiDefaultTempo is what a file plays at until its first tempo event, 120 BPM.
+const midiDefaultTempo = 500_000
+
+// MIDIInfo is what we know about a MIDI file besides its key and tempo.
+type MIDIInfo struct {
+	// Format is the SMF format: 0 is a single track, 1 is simultaneous tracks, 2 is independent sequences.
+	Format int
+	Tracks int
+	// TicksPerQuarter is the metrical division, 0 for files timed in SMPTE frames.
+	TicksPerQuarter int
+	// FramesPerSecond and TicksPerFrame are the division of SMPTE timed files, 29 meaning 29.97 drop frame.
+	FramesPerSecond int
+	TicksPerFrame   int
+	Tempo           TempoMap
+	// Kind is what the notes are for, see midiFile.kind.
+	Kind MIDIKind
+	// TimeSignature is the time signature at the start, e.g. "6/8", 4/4 unless the file says otherwise.
+	TimeSignature string
+	// Bars and Beats are the length, e.g. 3 bars and 2 beats, beats counted in the time signature's unit.
+	Bars  int
+	Beats int
+	// TrackNames holds the names of the file's tracks, for format 1 files the first is usually the song title.
+	TrackNames []string
+	// Instruments are the General MIDI instrument families that play notes, see gmFamilies.
+	Instruments []string
+	Notes       NoteStats
+}
+
+// WholeBars is the length in bars, counting a partial last bar as a whole one.
+func (mi *MIDIInfo) WholeBars() int {
+	if mi.Beats > 0 {
+		return mi.Bars + 1
+	}
+	return mi.Bars
+}
+
+// TempoMap summarizes a file's tempo events, all tempos in BPM. It's the zero value for files without any.
+type TempoMap struct {
+	// Initial is the tempo at the very start.
+	Initial float64
+	// Average is beats over minutes across the whole file.
+	Average float64
+	// Dominant is the tempo the file spends the most time at.
+	Dominant float64
+	// Changes counts tempo events that actually change the tempo.
+	Changes int
+}
+
+// midiNote is a single note from a MIDI file, timed in ticks.
+type midiNote struct {
+	Channel  uint8
+	Pitch    uint8
+	Velocity uint8
+	Start    uint64
+	Duration uint64
+}
+
+// timeSig is a time signature meta event.
+type timeSig struct {
+	Tick uint64
+	Num  int
+	Den  int
+}
+
+// tempoChange is a set tempo meta event.
+type tempoChange struct {
+	Tick uint64
+	// USPB is microseconds per quarter note.
+	USPB int
+}
+
+// midiFile is a decoded standard MIDI file. Format 2 sequences are laid end to end
+// so that everything shares a single timeline.
+type midiFile struct {
+	Format   int
+	Tracks   int
+	Division uint16
+	// KeySig is the first key signature meta event, zero value if there isn't one.
+	KeySig key.Key
+	Tempos   []tempoChange
+	TimeSigs []timeSig
+	Notes    []midiNote
+	// Length is the tick of the last end of track.
+	Length     uint64
+	TrackNames []string
+	// Families are the GM instrument families notes were played with, in order of appearance.
+	Families []string
+
+	// programs is the program selected on each channel, plus one so zero means none.
+	programs [16]int
+}
+
+// parseMIDI decodes a standard MIDI file.
 // No external dependency — parses the binary format directly.
-// Returns tempo in BPM (0 if not found) and key (zero value if not found).
-func parseMIDI(path string) (bpm int, k key.Key, err error) {
+func parseMIDI(path string) (*midiFile, error) {
 	f, err := os.Open(path)
 	if err != nil {
-		return 0, key.Key{}, err
+		return nil, err
 	}
 	defer f.Close()
 
 	// Read MIDI header chunk
-	var hdr [14]byte
+	var hdr [8]byte
 	if _, err = io.ReadFull(f, hdr[:]); err != nil {
-		return 0, key.Key{}, err
+		return nil, err
 	}
 	// MThd magic
 	if string(hdr[0:4]) != "MThd" {
-		return 0, key.Key{}, nil
+		return nil, errors.New("not a standard MIDI file")
+	}
+	hdrLen := binary.BigEndian.Uint32(hdr[4:8])
+	if hdrLen < 6 || hdrLen > 1<<16 {
+		return nil, fmt.Errorf("bad header chunk length %d", hdrLen)
+	}
+	hdrData := make([]byte, hdrLen)
+	if _, err = io.ReadFull(f, hdrData); err != nil {
+		return nil, err
+	}
+	m := &midiFile{
+		Format:   int(binary.BigEndian.Uint16(hdrData[0:2])),
+		Division: binary.BigEndian.Uint16(hdrData[4:6]),
+	}
+	numTracks := int(binary.BigEndian.Uint16(hdrData[2:4]))
+	if m.Division == 0 || m.Division&0x8000 != 0 && m.Division&0xFF == 0 {
+		return nil, errors.New("bad time division")
 	}
-	numTracks := int(binary.BigEndian.Uint16(hdr[10:12]))
 
-	// Walk tracks looking for meta events
-	for track := 0; track < numTracks; track++ {
+	for m.Tracks < numTracks {
 		var chunkHdr [8]byte
 		if _, err = io.ReadFull(f, chunkHdr[:]); err != nil {
 			break
 		}
+		chunkLen := int64(binary.BigEndian.Uint32(chunkHdr[4:8]))
 		if string(chunkHdr[0:4]) != "MTrk" {
-			break
+			// unknown chunk types are to be skipped
+			if _, err = io.CopyN(io.Discard, f, chunkLen); err != nil {
+				break
+			}
+			continue
+		}
+		// a truncated last track is common enough, take what's there
+		chunkData, rerr := io.ReadAll(io.LimitReader(f, chunkLen))
+
+		var offset uint64
+		if m.Format == 2 {
+			offset = m.Length
 		}
-		chunkLen := int(binary.BigEndian.Uint32(chunkHdr[4:8]))
-		chunkData := make([]byte, chunkLen)
-		if _, err = io.ReadFull(f, chunkData); err != nil {
+		m.parseTrack(chunkData, offset)
+		m.Tracks++
+		if rerr != nil || int64(len(chunkData)) < chunkLen {
 			break
 		}
+	}
+	if m.Tracks == 0 {
+		return nil, errors.New("no tracks")
+	}
+	sort.SliceStable(m.Tempos, func(i, j int) bool { return m.Tempos[i].Tick < m.Tempos[j].Tick })
+	sort.SliceStable(m.TimeSigs, func(i, j int) bool { return m.TimeSigs[i].Tick < m.TimeSigs[j].Tick })
+	return m, nil
+}
 
-		bpm, k = parseMIDITrack(chunkData, bpm, k)
-		if bpm > 0 && k.Root != 0 {
-			break // got what we need
+// readVLQ reads a variable-length quantity at data[i], returning it and the index after it.
+// Quantities are at most four bytes long, ok is false for anything longer or cut off.
+func readVLQ(data []byte, i int) (v int, next int, ok bool) {
+	for n := 0; n < 4 && i < len(data); n++ {
+		b := data[i]
+		i++
+		v = (v << 7) | int(b&0x7F)
+		if b&0x80 == 0 {
+			return v, i, true
 		}
 	}
-	return bpm, k, nil
+	return v, i, false
 }
 
-// parseMIDITrack scans a track's raw bytes for tempo and key signature meta events.
-func parseMIDITrack(data []byte, bpm int, k key.Key) (int, key.Key) {
+// parseTrack decodes a track's raw bytes, starting at tick offset.
+func (m *midiFile) parseTrack(data []byte, offset uint64) {
+	var (
+		tick    = offset
+		running byte
+		// sounding notes by channel and pitch, a pitch can be struck again before it's released.
+		open [16][128][]int
+	)
+	release := func(ch, pitch byte) {
+		stack := open[ch][pitch]
+		if len(stack) == 0 {
+			return
+		}
+		n := &m.Notes[stack[0]]
+		n.Duration = tick - n.Start
+		open[ch][pitch] = stack[1:]
+	}
+
 	i := 0
 	for i < len(data) {
-		// Read variable-length delta time
-		for i < len(data) {
-			b := data[i]
-			i++
-			if b&0x80 == 0 {
-				break
-			}
-		}
-		if i >= len(data) {
+		delta, next, ok := readVLQ(data, i)
+		if !ok || next >= len(data) {
 			break
 		}
+		i = next
+		tick += uint64(delta)
 
 		status := data[i]
-		i++
-
-		// Meta event: 0xFF
-		if status == 0xFF {
-			if i >= len(data) {
+		if status&0x80 == 0 {
+			// running status, this is already the first data byte
+			if running == 0 {
 				break
 			}
-			metaType := data[i]
+			status = running
+		} else {
 			i++
+		}
 
-			// Read variable-length meta event length
-			metaLen := 0
-			for i < len(data) {
-				b := data[i]
-				i++
-				metaLen = (metaLen << 7) | int(b&0x7F)
-				if b&0x80 == 0 {
+		if status == 0xFF || status == 0xF0 || status == 0xF7 {
+			// sysex and meta events cancel running status
+			running = 0
+			metaType := byte(0)
+			if status == 0xFF {
+				if i >= len(data) {
 					break
 				}
+				metaType = data[i]
+				i++
 			}
-
-			if i+metaLen > len(data) {
+			// meta events, sysex and the 0xF7 escape for arbitrary bytes all carry their length
+			length, next, ok := readVLQ(data, i)
+			if !ok || next+length > len(data) {
 				break
 			}
-			metaData := data[i : i+metaLen]
-			i += metaLen
-
-			switch metaType {
-			case 0x51: // Set Tempo — 3 bytes, microseconds per beat
-				if len(metaData) == 3 && bpm == 0 {
-					uspb := int(metaData[0])<<16 | int(metaData[1])<<8 | int(metaData[2])
-					if uspb > 0 {
-						bpm = 60_000_000 / uspb
-					}
-				}
+			i = next + length
+			if status != 0xFF {
+				continue
+			}
+			if metaType == 0x2F { // End of Track
+				break
+			}
+			m.meta(metaType, data[next:i], tick)
+			continue
+		}
 
-			case 0x59: // Key Signature — 2 bytes: sharps/flats, major/minor
-				if len(metaData) == 2 && k.Root == 0 {
-					k = midiKeySignature(int8(metaData[0]), metaData[1])
-				}
+		if status < 0xF0 {
+			running = status
+		}
+		n := midiEventDataLen(status)
+		if i+n > len(data) {
+			break
+		}
+		ev := data[i : i+n]
+		i += n
+
+		ch := status & 0x0F
+		switch status & 0xF0 {
+		case 0x90:
+			if ev[1] > 0 {
+				open[ch][ev[0]&0x7F] = append(open[ch][ev[0]&0x7F], len(m.Notes))
+				m.Notes = append(m.Notes, midiNote{Channel: ch, Pitch: ev[0] & 0x7F, Velocity: ev[1], Start: tick})
+				m.played(ch)
+				continue
 			}
+			// note on with zero velocity is a note off
+			release(ch, ev[0]&0x7F)
+		case 0x80:
+			release(ch, ev[0]&0x7F)
+		case 0xC0:
+			m.programs[ch] = int(ev[0]&0x7F) + 1
+		}
+	}
+
+	// anything still sounding ends with the track
+	for ch := range open {
+		for pitch := range open[ch] {
+			for range open[ch][pitch] {
+				release(byte(ch), byte(pitch))
+			}
+		}
+	}
+	if tick > m.Length {
+		m.Length = tick
+	}
+}
+
+// meta handles the meta events we care about.
+func (m *midiFile) meta(metaType byte, data []byte, tick uint64) {
+	switch metaType {
+	case 0x51: // Set Tempo — 3 bytes, microseconds per beat
+		if len(data) == 3 {
+			uspb := int(data[0])<<16 | int(data[1])<<8 | int(data[2])
+			if uspb > 0 {
+				m.Tempos = append(m.Tempos, tempoChange{Tick: tick, USPB: uspb})
+			}
+		}
+
+	case 0x59: // Key Signature — 2 bytes: sharps/flats, major/minor
+		if len(data) == 2 && m.KeySig.Root == 0 {
+			m.KeySig = midiKeySignature(int8(data[0]), data[1])
+		}
+
+	case 0x58: // Time Signature — numerator, denominator as a power of two, then metronome details
+		if len(data) >= 2 && data[0] > 0 && data[1] < 8 {
+			m.TimeSigs = append(m.TimeSigs, timeSig{Tick: tick, Num: int(data[0]), Den: 1 << data[1]})
+		}
+
+	case 0x03: // Track Name
+		if name := strings.TrimSpace(string(data)); name != "" {
+			m.TrackNames = append(m.TrackNames, name)
+		}
+	}
+}
+
+// gmFamilies are the General MIDI instrument families, eight programs each.
+var gmFamilies = []string{
+	"Piano", "Chromatic Percussion", "Organ", "Guitar", "Bass", "Strings", "Ensemble", "Brass",
+	"Reed", "Pipe", "Synth Lead", "Synth Pad", "Synth Effects", "Ethnic", "Percussive", "Sound Effects",
+}
+
+// played records the instrument family of a note played on ch. Channels without a program change
+// aren't counted, the default piano says nothing about what the part was written for.
+func (m *midiFile) played(ch uint8) {
+	family := ""
+	switch {
+	case ch == midiDrumChannel:
+		family = "Drums"
+	case m.programs[ch] > 0:
+		family = gmFamilies[(m.programs[ch]-1)/8]
+	default:
+		return
+	}
+	for _, f := range m.Families {
+		if f == family {
+			return
+		}
+	}
+	m.Families = append(m.Families, family)
+}
+
+// length returns the length of the file in bars, both as a fraction and as whole bars and beats,
+// and the time signature it starts in.
+func (m *midiFile) length() (total float64, bars, beats int, sig timeSig) {
+	sigs := []timeSig{{Tick: 0, Num: 4, Den: 4}}
+	for _, ts := range m.TimeSigs {
+		if last := &sigs[len(sigs)-1]; ts.Tick == last.Tick {
+			*last = ts
+			continue
+		}
+		sigs = append(sigs, ts)
+	}
+	quarter := float64(m.ticksPerBeat())
+	if quarter == 0 {
+		return 0, 0, 0, sigs[0]
+	}
+	for i, ts := range sigs {
+		end := m.Length
+		if i+1 < len(sigs) {
+			end = sigs[i+1].Tick
+		}
+		if end > ts.Tick {
+			// ticks to beats of the signature's unit, then to bars
+			total += float64(end-ts.Tick) / (quarter * 4 / float64(ts.Den)) / float64(ts.Num)
+		}
+	}
+	last := sigs[len(sigs)-1].Num
+	bars = int(total)
+	beats = int(math.Round((total - float64(bars)) * float64(last)))
+	if beats == last {
+		bars, beats = bars+1, 0
+	}
+	return total, bars, beats, sigs[0]
+}
+
+// smpte returns the frames per second and ticks per frame of an SMPTE timed file, ok is false for metrical timing.
+func (m *midiFile) smpte() (fps float64, tpf int, ok bool) {
+	if m.Division&0x8000 == 0 {
+		return 0, 0, false
+	}
+	fps = float64(-int8(m.Division >> 8))
+	if fps == 29 {
+		fps = 29.97
+	}
+	return fps, int(m.Division & 0xFF), true
+}
+
+// span converts ticks at a tempo into beats and seconds.
+func (m *midiFile) span(ticks uint64, uspb int) (beats, seconds float64) {
+	if fps, tpf, ok := m.smpte(); ok {
+		seconds = float64(ticks) / (fps * float64(tpf))
+		return seconds * 1e6 / float64(uspb), seconds
+	}
+	beats = float64(ticks) / float64(m.Division)
+	return beats, beats * float64(uspb) / 1e6
+}
+
+// ticksPerBeat returns how many ticks long a quarter note is, at the initial tempo for SMPTE timed files.
+func (m *midiFile) ticksPerBeat() uint64 {
+	if fps, tpf, ok := m.smpte(); ok {
+		return uint64(fps * float64(tpf) * float64(m.segments()[0].USPB) / 1e6)
+	}
+	return uint64(m.Division)
+}
+
+// segments returns the tempo in effect over each stretch of the file, in order.
+func (m *midiFile) segments() []tempoChange {
+	segs := []tempoChange{{Tick: 0, USPB: midiDefaultTempo}}
+	for _, t := range m.Tempos {
+		last := &segs[len(segs)-1]
+		if t.Tick == last.Tick {
+			// a later event at the same tick wins
+			last.USPB = t.USPB
+			continue
+		}
+		segs = append(segs, t)
+	}
+	return segs
+}
+
+// tempoMap summarizes the file's tempo events.
+func (m *midiFile) tempoMap() TempoMap {
+	if len(m.Tempos) == 0 {
+		return TempoMap{}
+	}
+	segs := m.segments()
+	tm := TempoMap{Initial: bpm(segs[0].USPB)}
+	timeAt := make(map[int]float64)
+	var beats, seconds float64
+	for i, seg := range segs {
+		if i > 0 && seg.USPB != segs[i-1].USPB {
+			tm.Changes++
+		}
+		end := m.Length
+		if i+1 < len(segs) {
+			end = segs[i+1].Tick
+		}
+		if end <= seg.Tick {
 			continue
 		}
+		b, s := m.span(end-seg.Tick, seg.USPB)
+		beats += b
+		seconds += s
+		timeAt[seg.USPB] += s
+	}
+	if seconds == 0 {
+		// nothing to play, the last tempo set is all we have
+		last := bpm(segs[len(segs)-1].USPB)
+		tm.Average, tm.Dominant = last, last
+		return tm
+	}
+	tm.Average = math.Round(beats/(seconds/60)*100) / 100
+	var most float64
+	for uspb, s := range timeAt {
+		if s > most || (s == most && bpm(uspb) > tm.Dominant) {
+			most, tm.Dominant = s, bpm(uspb)
+		}
+	}
+	return tm
+}
 
-		// Skip non-meta events by inferring data length from status byte
-		i += midiEventDataLen(status, data, i)
+// duration is how long the file plays for.
+func (m *midiFile) duration() time.Duration {
+	segs := m.segments()
+	var seconds float64
+	for i, seg := range segs {
+		end := m.Length
+		if i+1 < len(segs) {
+			end = segs[i+1].Tick
+		}
+		if end > seg.Tick {
+			_, s := m.span(end-seg.Tick, seg.USPB)
+			seconds += s
+		}
 	}
-	return bpm, k
+	return time.Duration(seconds * float64(time.Second))
+}
+
+// info returns the exported summary of the file.
+func (m *midiFile) info() *MIDIInfo {
+	mi := &MIDIInfo{
+		Format: m.Format, Tracks: m.Tracks, Tempo: m.tempoMap(), Kind: m.kind(),
+		TrackNames: m.TrackNames, Instruments: m.Families,
+	}
+	total, bars, beats, sig := m.length()
+	mi.Bars, mi.Beats = bars, beats
+	mi.TimeSignature = fmt.Sprintf("%d/%d", sig.Num, sig.Den)
+	mi.Notes = m.noteStats(total)
+	if fps, tpf, ok := m.smpte(); ok {
+		mi.FramesPerSecond, mi.TicksPerFrame = int(fps), tpf
+	} else {
+		mi.TicksPerQuarter = int(m.Division)
+	}
+	return mi
+}
+
+// bpm converts microseconds per quarter note to beats per minute, rounded to a hundredth.
+func bpm(uspb int) float64 {
+	return math.Round(60_000_000/float64(uspb)*100) / 100
+}
+
+// chroma returns the duration weighted pitch class histogram of the file's pitched notes,
+// indexed from C, or nil if there are none.
+func (m *midiFile) chroma() []float64 {
+	chroma := make([]float64, 12)
+	var total float64
+	for _, n := range m.Notes {
+		if n.Channel == midiDrumChannel {
+			continue
+		}
+		d := float64(n.Duration)
+		if d == 0 {
+			// a note with no length still happened
+			d = 1
+		}
+		chroma[n.Pitch%12] += d
+		total += d
+	}
+	if total == 0 {
+		return nil
+	}
+	for i := range chroma {
+		chroma[i] /= total
+	}
+	return chroma
 }
 
 // midiKeySignature converts MIDI key signature bytes to a music-theory key.
@@ -125,16 +547,20 @@ func midiKeySignature(sf int8, mi byte) key.Key {
 	// Order of sharps: F C G D A E B
 	// Order of flats:  B E A D G C F
 	noteNames := []string{"Cb", "Gb", "Db", "Ab", "Eb", "Bb", "F", "C", "G", "D", "A", "E", "B", "F#", "C#"}
+	mode := "major"
+	if mi == 1 {
+		// relative minors share the signature
+		noteNames = []string{"Ab", "Eb", "Bb", "F", "C", "G", "D", "A", "E", "B", "F#", "C#", "G#", "D#", "A#"}
+		mode = "minor"
+	}
 	idx := int(sf) + 7
 	if idx < 0 { idx = 0 }
 	if idx >= len(noteNames) { idx = len(noteNames) - 1 }
-	mode := "major"
-	if mi == 1 { mode = "minor" }
 	return key.Of(noteNames[idx] + " " + mode)
 }
 
-// midiEventDataLen returns how many data bytes follow a given status byte.
-func midiEventDataLen(status byte, data []byte, pos int) int {
+// midiEventDataLen returns how many data bytes follow a channel or system common status byte.
+func midiEventDataLen(status byte) int {
 	switch status & 0xF0 {
 	case 0x80, 0x90, 0xA0, 0xB0, 0xE0:
 		return 2
@@ -142,20 +568,9 @@ func midiEventDataLen(status byte, data []byte, pos int) int {
 		return 1
 	case 0xF0:
 		switch status {
-		case 0xF0, 0xF7: // SysEx — variable length
-			length := 0
-			for pos < len(data) {
-				b := data[pos]
-				pos++
-				length++
-				if b == 0xF7 {
-					break
-				}
-			}
-			return length
 		case 0xF2:
 			return 2
-		case 0xF3:
+		case 0xF1, 0xF3:
 			return 1
 		default:
 			return 0
@@ -163,3 +578,51 @@ func midiEventDataLen(status byte, data []byte, pos int) int {
 	}
 	return 0
 }
+
+// applyMIDI fills in tempo, duration and key from a decoded MIDI file. The key comes from the notes
+// themselves when there are any, key signature events are too often missing or left at C major.
+func (s *Sample) applyMIDI(m *midiFile) {
+	s.MIDI = m.info()
+	if s.MIDI.Tempo.Changes > 0 {
+		log.Debug().Str("path", s.Path).Str("phase", PhaseAnalysis).Interface("tempo", s.MIDI.Tempo).Msg("tempo changes")
+	}
+	if dominant := int(math.Round(s.MIDI.Tempo.Dominant)); dominant > 0 {
+		s.TempoCandidates = appendTempo(s.TempoCandidates, dominant)
+		if s.Tempo == 0 {
+			s.Tempo = dominant
+			s.TempoSource = FromTempoMap
+		}
+	}
+	if m.Length > 0 {
+		s.Duration = m.duration()
+	}
+	chroma := m.chroma()
+	if chroma == nil {
+		if m.KeySig.Root != 0 && s.Key.Root == 0 {
+			s.Key = m.KeySig
+			s.KeySource = FromKeySignature
+		}
+		return
+	}
+	guess := analysis.EstimateKeyFromChroma(chroma)
+	s.KeyCandidates = guess.Candidates
+	s.Chroma = normalizeChroma(chroma)
+	detected := guess.Best.Key
+	s.KeySource = FromNotes
+	switch {
+	case s.Key.Root == 0:
+		s.Key = detected
+	case s.Key != detected:
+		log.Warn().Str("path", s.Path).Str("phase", PhaseAnalysis).Str("attribute", "key").Str("source", FromNotes).
+			Float64("confidence", guess.Best.Score).Msgf("key mismatch: filename=%s notes=%s, trusting notes",
+			s.Key.Root.String(s.Key.AdjSymbol), detected.Root.String(detected.AdjSymbol))
+		Run.Mismatch(Mismatch{
+			Path: s.Path, Attribute: "key", Filename: keyName(s.Key),
+			Acoustic: keyName(detected), Confidence: guess.Best.Score,
+		})
+		s.Key = detected
+	}
+	if s.MIDI.Kind == MIDIChords {
+		s.Progression = m.progression(s.Key)
+	}
+}
@@ -0,0 +1,249 @@
+package collect
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"gopkg.in/music-theory.v0/key"
+)
+
+// smf wraps raw track bodies into a format 1 standard MIDI file with 96 ticks per quarter note.
+func smf(tracks ...[]byte) []byte {
+	return smfFormat(1, 96, tracks...)
+}
+
+func smfFormat(format, division uint16, tracks ...[]byte) []byte {
+	var b bytes.Buffer
+	b.WriteString("MThd")
+	_ = binary.Write(&b, binary.BigEndian, []uint32{6})
+	_ = binary.Write(&b, binary.BigEndian, []uint16{format, uint16(len(tracks)), division})
+	for _, t := range tracks {
+		b.WriteString("MTrk")
+		_ = binary.Write(&b, binary.BigEndian, uint32(len(t)))
+		b.Write(t)
+	}
+	return b.Bytes()
+}
+
+func writeMIDI(t *testing.T, data []byte) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "test.mid")
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestParseMIDI_Notes(t *testing.T) {
+	track := []byte{
+		0x00, 0xFF, 0x51, 0x03, 0x07, 0xA1, 0x20, // 120 BPM
+		0x00, 0xFF, 0x59, 0x02, 0x00, 0x00, // C major, which the notes disagree with
+		// A minor triad, then running status with zero velocity note offs
+		0x00, 0x90, 57, 100,
+		0x00, 60, 90,
+		0x00, 64, 80,
+		0x83, 0x00, 57, 0, // 384 ticks later
+		0x00, 60, 0,
+		0x00, 64, 0,
+		// a long A, released with a real note off
+		0x00, 0x90, 45, 100,
+		0x86, 0x00, 0x80, 45, 64,
+		// drums don't count
+		0x00, 0x99, 36, 127,
+		0x60, 0x89, 36, 0,
+		// never released, runs to the end of the track
+		0x00, 0x90, 69, 70,
+		0x60, 0xFF, 0x2F, 0x00,
+	}
+	m, err := parseMIDI(writeMIDI(t, smf(track)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(m.Tempos) != 1 || bpm(m.Tempos[0].USPB) != 120 {
+		t.Errorf("Tempos = %+v, want a single 120 BPM", m.Tempos)
+	}
+	if m.Division != 96 {
+		t.Errorf("Division = %d, want 96", m.Division)
+	}
+	if len(m.Notes) != 6 {
+		t.Fatalf("got %d notes, want 6: %+v", len(m.Notes), m.Notes)
+	}
+	for i, want := range []midiNote{
+		{Channel: 0, Pitch: 57, Velocity: 100, Start: 0, Duration: 384},
+		{Channel: 0, Pitch: 60, Velocity: 90, Start: 0, Duration: 384},
+		{Channel: 0, Pitch: 64, Velocity: 80, Start: 0, Duration: 384},
+		{Channel: 0, Pitch: 45, Velocity: 100, Start: 384, Duration: 768},
+		{Channel: 9, Pitch: 36, Velocity: 127, Start: 1152, Duration: 96},
+		{Channel: 0, Pitch: 69, Velocity: 70, Start: 1248, Duration: 96},
+	} {
+		if m.Notes[i] != want {
+			t.Errorf("note %d = %+v, want %+v", i, m.Notes[i], want)
+		}
+	}
+
+	s := &Sample{Name: "chords_C.mid", Key: key.Of("C major")}
+	s.applyMIDI(m)
+	if want := key.Of("A minor"); s.Key != want {
+		t.Errorf("Key = %v, want %v (candidates %+v)", s.Key, want, s.KeyCandidates)
+	}
+	if len(s.KeyCandidates) == 0 || s.KeyCandidates[0].Key != s.Key {
+		t.Errorf("KeyCandidates = %+v, want the detected key first", s.KeyCandidates)
+	}
+	if s.Tempo != 120 {
+		t.Errorf("Tempo = %d, want 120", s.Tempo)
+	}
+}
+
+func TestApplyMIDI_KeySignatureFallback(t *testing.T) {
+	track := []byte{
+		0x00, 0xFF, 0x59, 0x02, 0xFD, 0x01, // three flats, minor
+		0x00, 0x99, 36, 127, // only drums
+		0x60, 0x89, 36, 0,
+		0x00, 0xFF, 0x2F, 0x00,
+	}
+	m, err := parseMIDI(writeMIDI(t, smf(track)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &Sample{Name: "beat.mid"}
+	s.applyMIDI(m)
+	if want := key.Of("C minor"); s.Key != want {
+		t.Errorf("Key = %v, want %v", s.Key, want)
+	}
+	if s.KeyCandidates != nil {
+		t.Errorf("KeyCandidates = %+v, want none without pitched notes", s.KeyCandidates)
+	}
+}
+
+func TestParseMIDI_RunningStatusAcrossEvents(t *testing.T) {
+	track := []byte{
+		0x00, 0x90, 60, 100,
+		0x00, 0xF0, 0x03, 0x7E, 0x7F, 0xF7, // sysex, its length is a VLQ
+		0x00, 0xF7, 0x02, 0x90, 0x40, // escaped bytes that look like a note on
+		0x00, 0x90, 64, 100, // sysex cancels running status, so it's restated
+		0x60, 0xB0, 64, 127, // sustain
+		0x00, 0x80, 60, 0,
+		0x00, 64, 0, // running status note off
+		0x00, 0xFF, 0x2F, 0x00,
+		0x00, 0x90, 67, 100, // after end of track, ignored
+	}
+	m, err := parseMIDI(writeMIDI(t, smf(track)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(m.Notes) != 2 {
+		t.Fatalf("got %d notes, want 2: %+v", len(m.Notes), m.Notes)
+	}
+	for _, n := range m.Notes {
+		if n.Duration != 96 {
+			t.Errorf("note %d lasted %d ticks, want 96", n.Pitch, n.Duration)
+		}
+	}
+}
+
+func TestParseMIDI_TempoMap(t *testing.T) {
+	conductor := []byte{
+		0x00, 0xFF, 0x51, 0x03, 0x07, 0xA1, 0x20, // 120 BPM
+		0x83, 0x00, 0xFF, 0x51, 0x03, 0x07, 0xA1, 0x20, // 120 again at beat 4, not a change
+		0x83, 0x00, 0xFF, 0x51, 0x03, 0x09, 0x27, 0xC0, // 100 BPM at beat 8
+		0x00, 0xFF, 0x2F, 0x00,
+	}
+	notes := []byte{
+		0x00, 0x90, 60, 100,
+		0x8C, 0x00, 60, 0, // 16 beats
+		0x00, 0xFF, 0x2F, 0x00,
+	}
+	m, err := parseMIDI(writeMIDI(t, smf(conductor, notes)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 8 beats at 120 is 4s, 8 beats at 100 is 4.8s: 16 beats over 8.8s
+	want := TempoMap{Initial: 120, Average: 109.09, Dominant: 100, Changes: 1}
+	if got := m.tempoMap(); got != want {
+		t.Errorf("tempoMap() = %+v, want %+v", got, want)
+	}
+	if got, want := m.duration(), 8800*time.Millisecond; got != want {
+		t.Errorf("duration() = %v, want %v", got, want)
+	}
+}
+
+func TestParseMIDI_Format2(t *testing.T) {
+	pattern := []byte{
+		0x00, 0x90, 60, 100,
+		0x83, 0x00, 60, 0,
+		0x00, 0xFF, 0x2F, 0x00,
+	}
+	m, err := parseMIDI(writeMIDI(t, smfFormat(2, 96, pattern, pattern)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Tracks != 2 || m.Length != 768 {
+		t.Errorf("Tracks = %d, Length = %d, want 2 sequences played one after another", m.Tracks, m.Length)
+	}
+	if len(m.Notes) != 2 || m.Notes[1].Start != 384 {
+		t.Errorf("Notes = %+v, want the second sequence to start at 384", m.Notes)
+	}
+}
+
+func TestParseMIDI_SMPTE(t *testing.T) {
+	track := []byte{
+		0x00, 0xFF, 0x51, 0x03, 0x07, 0xA1, 0x20, // 120 BPM
+		0x00, 0x90, 60, 100,
+		0x87, 0x68, 60, 0, // 1000 ticks
+		0x00, 0xFF, 0x2F, 0x00,
+	}
+	// 25 fps, 40 ticks per frame: a millisecond per tick
+	m, err := parseMIDI(writeMIDI(t, smfFormat(0, uint16(0xE7)<<8|40, track)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	info := m.info()
+	if info.FramesPerSecond != 25 || info.TicksPerFrame != 40 || info.TicksPerQuarter != 0 {
+		t.Errorf("info() = %+v, want 25 fps at 40 ticks per frame", info)
+	}
+	if got := m.duration(); got != time.Second {
+		t.Errorf("duration() = %v, want 1s", got)
+	}
+	if info.Tempo.Average != 120 {
+		t.Errorf("Tempo = %+v, want 120 BPM", info.Tempo)
+	}
+}
+
+func TestParseMIDI_Metadata(t *testing.T) {
+	conductor := []byte{
+		0x00, 0xFF, 0x03, 0x05, 'S', 'o', 'n', 'g', ' ',
+		0x00, 0xFF, 0x58, 0x04, 0x06, 0x03, 0x18, 0x08, // 6/8
+		0x00, 0xFF, 0x2F, 0x00,
+	}
+	lead := []byte{
+		0x00, 0xFF, 0x03, 0x04, 'L', 'e', 'a', 'd',
+		0x00, 0xC0, 81, // Lead 2 (sawtooth)
+		0x00, 0x90, 72, 100,
+		0x85, 0x20, 72, 0, // two bars and two eighths
+		0x00, 0xFF, 0x2F, 0x00,
+	}
+	drums := []byte{
+		0x00, 0x99, 36, 100,
+		0x60, 0x89, 36, 0,
+		0x00, 0xFF, 0x2F, 0x00,
+	}
+	m, err := parseMIDI(writeMIDI(t, smf(conductor, lead, drums)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	info := m.info()
+	if info.TimeSignature != "6/8" || info.Bars != 2 || info.Beats != 2 || info.WholeBars() != 3 {
+		t.Errorf("TimeSignature = %s, Bars = %d, Beats = %d, want 6/8 2 bars and 2 beats", info.TimeSignature, info.Bars, info.Beats)
+	}
+	if want := []string{"Song", "Lead"}; !reflect.DeepEqual(info.TrackNames, want) {
+		t.Errorf("TrackNames = %q, want %q", info.TrackNames, want)
+	}
+	if want := []string{"Synth Lead", "Drums"}; !reflect.DeepEqual(info.Instruments, want) {
+		t.Errorf("Instruments = %q, want %q", info.Instruments, want)
+	}
+}
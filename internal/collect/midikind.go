@@ -0,0 +1,151 @@
+package collect
+
+import (
+	"sort"
+	"strings"
+)
+
+// MIDIKind is what a MIDI file's notes are for.
+type MIDIKind uint8
+
+const (
+	MIDIUnknown MIDIKind = iota
+	MIDIDrums
+	MIDIChords
+	MIDIMelody
+	MIDIBass
+)
+
+var midiKindNames = map[MIDIKind]string{
+	MIDIUnknown: "unknown", MIDIDrums: "drums", MIDIChords: "chords", MIDIMelody: "melody", MIDIBass: "bass",
+}
+
+// midiKindToDirMap names the view directory under MIDI/ for each kind.
+var midiKindToDirMap = map[MIDIKind]string{
+	MIDIDrums: "Drums", MIDIChords: "Chords", MIDIMelody: "Melodies", MIDIBass: "Basslines",
+}
+
+func (k MIDIKind) String() string {
+	if name, ok := midiKindNames[k]; ok {
+		return name
+	}
+	return "unknown"
+}
+
+// ParseMIDIKind returns the MIDIKind matching name, as printed by MIDIKind.String.
+func ParseMIDIKind(name string) (MIDIKind, bool) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	for k, n := range midiKindNames {
+		if n == name {
+			return k, true
+		}
+	}
+	return MIDIUnknown, false
+}
+
+const (
+	// chordPolyphony is how many notes have to sound together to call it a chord.
+	chordPolyphony = 3
+	// bassCeiling is the median pitch below which a single line is a bassline, E3.
+	bassCeiling = 52
+)
+
+// gmDrumRoles maps the General MIDI percussion notes sample pack drum MIDI actually uses to a rough role,
+// so drum parts written on a melodic channel can still be recognized.
+var gmDrumRoles = map[uint8]string{
+	35: "kick", 36: "kick",
+	37: "snare", 38: "snare", 39: "snare", 40: "snare",
+	42: "hat", 44: "hat", 46: "hat",
+	49: "cymbal", 51: "cymbal", 57: "cymbal",
+}
+
+// kind classifies the file by its notes: drums if they're on the GM percussion channel or look like a drum
+// kit, chords if most onsets are polyphonic, otherwise melody or bass depending on the register.
+func (m *midiFile) kind() MIDIKind {
+	if len(m.Notes) == 0 {
+		return MIDIUnknown
+	}
+	var drums, kit int
+	roles := make(map[string]bool)
+	var pitched []midiNote
+	for _, n := range m.Notes {
+		if n.Channel == midiDrumChannel {
+			drums++
+			continue
+		}
+		if role, ok := gmDrumRoles[n.Pitch]; ok {
+			kit++
+			roles[role] = true
+		}
+		pitched = append(pitched, n)
+	}
+	if drums*2 >= len(m.Notes) {
+		return MIDIDrums
+	}
+	// a drum part on a melodic channel: nearly everything on kit notes, with hats or cymbals alongside a kick or snare
+	if kit*10 >= len(pitched)*9 && (roles["hat"] || roles["cymbal"]) && (roles["kick"] || roles["snare"]) {
+		return MIDIDrums
+	}
+
+	var onsets, chords int
+	for _, poly := range polyphonyAtOnsets(pitched) {
+		onsets++
+		if poly >= chordPolyphony {
+			chords++
+		}
+	}
+	if chords*2 >= onsets {
+		return MIDIChords
+	}
+	if medianPitch(pitched) < bassCeiling {
+		return MIDIBass
+	}
+	return MIDIMelody
+}
+
+// polyphonyAtOnsets returns, for every tick a note starts on, how many distinct pitches are sounding.
+func polyphonyAtOnsets(notes []midiNote) map[uint64]int {
+	sorted := append([]midiNote(nil), notes...)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].Start < sorted[j].Start })
+	poly := make(map[uint64]int)
+	var sounding []midiNote
+	for i := 0; i < len(sorted); {
+		tick := sorted[i].Start
+		kept := sounding[:0]
+		for _, n := range sounding {
+			if n.Start+n.Duration > tick {
+				kept = append(kept, n)
+			}
+		}
+		sounding = kept
+		for ; i < len(sorted) && sorted[i].Start == tick; i++ {
+			sounding = append(sounding, sorted[i])
+		}
+		pitches := make(map[uint8]bool, len(sounding))
+		for _, n := range sounding {
+			pitches[n.Pitch] = true
+		}
+		poly[tick] = len(pitches)
+	}
+	return poly
+}
+
+// medianPitch returns the median pitch of notes, weighted by duration.
+func medianPitch(notes []midiNote) uint8 {
+	if len(notes) == 0 {
+		return 0
+	}
+	sorted := append([]midiNote(nil), notes...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Pitch < sorted[j].Pitch })
+	var total, seen uint64
+	for _, n := range sorted {
+		total += n.Duration + 1
+	}
+	for _, n := range sorted {
+		seen += n.Duration + 1
+		if seen*2 >= total {
+			return n.Pitch
+		}
+	}
+	return sorted[len(sorted)-1].Pitch
+}
@@ -0,0 +1,33 @@
+package collect
+
+import "testing"
+
+func TestMIDIFile_Kind(t *testing.T) {
+	note := func(ch, pitch uint8, start, dur uint64) midiNote {
+		return midiNote{Channel: ch, Pitch: pitch, Velocity: 100, Start: start, Duration: dur}
+	}
+	tests := []struct {
+		name  string
+		notes []midiNote
+		want  MIDIKind
+	}{
+		{"empty", nil, MIDIUnknown},
+		{"channel 10", []midiNote{note(9, 36, 0, 24), note(9, 38, 96, 24), note(0, 60, 0, 96)}, MIDIDrums},
+		{"kit on channel 1", []midiNote{note(0, 36, 0, 24), note(0, 42, 0, 24), note(0, 38, 96, 24), note(0, 42, 96, 24)}, MIDIDrums},
+		{"bass on kit notes", []midiNote{note(0, 36, 0, 96), note(0, 38, 96, 96), note(0, 40, 192, 96), note(0, 43, 288, 96)}, MIDIBass},
+		{"triads", []midiNote{
+			note(0, 57, 0, 384), note(0, 60, 0, 384), note(0, 64, 0, 384),
+			note(0, 53, 384, 384), note(0, 57, 384, 384), note(0, 60, 384, 384),
+		}, MIDIChords},
+		{"lead", []midiNote{note(0, 72, 0, 48), note(0, 74, 48, 48), note(0, 76, 96, 96), note(0, 79, 192, 96)}, MIDIMelody},
+		{"legato lead", []midiNote{note(0, 72, 0, 60), note(0, 74, 48, 60), note(0, 76, 96, 96)}, MIDIMelody},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := &midiFile{Division: 96, Notes: tt.notes}
+			if got := m.kind(); got != tt.want {
+				t.Errorf("kind() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,113 @@
+package collect
+
+import "math"
+
+// NoteStats describe the notes of a MIDI file, for browsing clips without listening to them.
+type NoteStats struct {
+	Count int
+	// Lowest and Highest are MIDI note numbers of pitched notes, Range is the distance between them in semitones.
+	Lowest  int
+	Highest int
+	Range   int
+	// Density is notes per bar.
+	Density float64
+	// Velocity is the average note on velocity.
+	Velocity float64
+	// Swing is where off-beat notes land between two on-beat ones, in percent: 50 is straight, 66.7 is a triplet shuffle.
+	Swing float64
+	// OffGrid is how far notes are from the sixteenth note grid on average, in percent of a sixteenth.
+	OffGrid float64
+	// Polyphony is the average number of distinct pitches sounding whenever a pitched note starts, MaxPolyphony the most.
+	Polyphony    float64
+	MaxPolyphony int
+}
+
+// noteStats computes NoteStats, bars is the length of the file in (fractional) bars.
+func (m *midiFile) noteStats(bars float64) NoteStats {
+	st := NoteStats{Count: len(m.Notes), Swing: 50}
+	if st.Count == 0 {
+		return st
+	}
+	var pitched []midiNote
+	var velocity float64
+	st.Lowest = 128
+	for _, n := range m.Notes {
+		velocity += float64(n.Velocity)
+		if n.Channel == midiDrumChannel {
+			continue
+		}
+		pitched = append(pitched, n)
+		if int(n.Pitch) < st.Lowest {
+			st.Lowest = int(n.Pitch)
+		}
+		if int(n.Pitch) > st.Highest {
+			st.Highest = int(n.Pitch)
+		}
+	}
+	if len(pitched) == 0 {
+		st.Lowest = 0
+	}
+	st.Range = st.Highest - st.Lowest
+	st.Velocity = round2(velocity / float64(st.Count))
+	if bars > 0 {
+		st.Density = round2(float64(st.Count) / bars)
+	}
+
+	onsets := polyphonyAtOnsets(pitched)
+	for _, poly := range onsets {
+		st.Polyphony += float64(poly)
+		if poly > st.MaxPolyphony {
+			st.MaxPolyphony = poly
+		}
+	}
+	if len(onsets) > 0 {
+		st.Polyphony = round2(st.Polyphony / float64(len(onsets)))
+	}
+
+	st.Swing, st.OffGrid = m.groove()
+	return st
+}
+
+// groove estimates swing and how loosely the notes are played. Swing is measured on eighth notes,
+// or on sixteenths when a good share of the notes sit early in the beat.
+func (m *midiFile) groove() (swing, offGrid float64) {
+	beat := float64(m.ticksPerBeat())
+	if beat == 0 || len(m.Notes) == 0 {
+		return 50, 0
+	}
+	sixteenth := beat / 4
+	var early int
+	for _, n := range m.Notes {
+		off := math.Mod(float64(n.Start), sixteenth) / sixteenth
+		offGrid += math.Min(off, 1-off)
+		// in the first half of the beat but clearly off it, only sixteenths land there
+		if pos := math.Mod(float64(n.Start), beat) / beat; pos > 0.1 && pos < 0.45 {
+			early++
+		}
+	}
+	offGrid = round2(offGrid / float64(len(m.Notes)) * 100)
+
+	// pair is an on-beat note and the off-beat one that follows it
+	pair := beat
+	if early*4 >= len(m.Notes) {
+		pair = beat / 2
+	}
+	var delay float64
+	var offBeats int
+	for _, n := range m.Notes {
+		pos := math.Mod(float64(n.Start), pair) / pair
+		// off-beat notes land somewhere between a quarter and most of the way through the pair
+		if pos > 0.25 && pos < 0.85 {
+			delay += pos
+			offBeats++
+		}
+	}
+	if offBeats == 0 {
+		return 50, offGrid
+	}
+	return round2(delay / float64(offBeats) * 100), offGrid
+}
+
+func round2(f float64) float64 {
+	return math.Round(f*100) / 100
+}
@@ -0,0 +1,48 @@
+package collect
+
+import "testing"
+
+func TestMIDIFile_NoteStats(t *testing.T) {
+	eighths := func(offbeat uint64) []midiNote {
+		var notes []midiNote
+		for beat := uint64(0); beat < 8; beat++ {
+			notes = append(notes,
+				midiNote{Pitch: 60, Velocity: 100, Start: beat * 96, Duration: 80},
+				midiNote{Pitch: 67, Velocity: 60, Start: beat*96 + offbeat, Duration: 20},
+			)
+		}
+		return notes
+	}
+	straight := (&midiFile{Division: 96, Notes: eighths(48), Length: 768}).noteStats(2)
+	if straight.Swing != 50 || straight.OffGrid != 0 {
+		t.Errorf("straight eighths: Swing = %v, OffGrid = %v, want 50 and 0", straight.Swing, straight.OffGrid)
+	}
+	if straight.Count != 16 || straight.Density != 8 || straight.Velocity != 80 {
+		t.Errorf("Count = %d, Density = %v, Velocity = %v, want 16, 8 and 80", straight.Count, straight.Density, straight.Velocity)
+	}
+	if straight.Lowest != 60 || straight.Highest != 67 || straight.Range != 7 {
+		t.Errorf("Lowest = %d, Highest = %d, Range = %d", straight.Lowest, straight.Highest, straight.Range)
+	}
+	if straight.MaxPolyphony != 2 || straight.Polyphony != 1.5 {
+		t.Errorf("Polyphony = %v, MaxPolyphony = %d, want 1.5 and 2", straight.Polyphony, straight.MaxPolyphony)
+	}
+
+	shuffled := (&midiFile{Division: 96, Notes: eighths(64), Length: 768}).noteStats(2)
+	if shuffled.Swing != 66.67 || shuffled.OffGrid != 16.67 {
+		t.Errorf("triplet shuffle: Swing = %v, OffGrid = %v, want 66.67 and 16.67", shuffled.Swing, shuffled.OffGrid)
+	}
+
+	var sixteenths []midiNote
+	for i := uint64(0); i < 16; i++ {
+		// swung sixteenths, every other one late
+		sixteenths = append(sixteenths, midiNote{Pitch: 42, Velocity: 90, Start: i/2*48 + i%2*32})
+	}
+	if swing := (&midiFile{Division: 96, Notes: sixteenths, Length: 768}).noteStats(2).Swing; swing != 66.67 {
+		t.Errorf("swung sixteenths: Swing = %v, want 66.67", swing)
+	}
+
+	empty := (&midiFile{Division: 96}).noteStats(0)
+	if empty != (NoteStats{Swing: 50}) {
+		t.Errorf("no notes: %+v", empty)
+	}
+}
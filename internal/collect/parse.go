@@ -20,6 +20,7 @@ import (
 
 	"git.tcp.direct/kayos/keepr/internal/analysis"
 	"git.tcp.direct/kayos/keepr/internal/config"
+	"git.tcp.direct/kayos/keepr/internal/util"
 )
 
 var lockMap = make(map[string]*sync.Mutex)
@@ -134,10 +135,7 @@ var melodicKeywords = []string{
 func (s *Sample) ParseFilename() {
 	atomic.AddInt32(&Backlog, 1)
 	defer atomic.AddInt32(&Backlog, -1)
-	slog := log.With().Str("caller", s.Path).Logger()
-	if s.Name != "" {
-		slog = slog.With().Str("caller", s.Name).Logger()
-	}
+	slog := log.With().Str("path", s.Path).Str("phase", PhaseAnalysis).Logger()
 	pd := s.getParentDir()
 	path := strings.ReplaceAll(strings.TrimSpace(strings.ToLower(s.Path)), " ", "_")
 	fname := strings.ToLower(filepath.Base(path))
@@ -151,7 +149,7 @@ func (s *Sample) ParseFilename() {
 		if drumtype, isdrum := drumDirMap[c]; isdrum {
 			slog.Trace().Msgf("found drum type: %s", c)
 			s.Types[TypeDrum] = struct{}{}
-			go Library.IngestDrum(s, drumtype)
+			s.DrumType = drumtype
 			break
 		}
 	}
@@ -222,13 +220,20 @@ func (s *Sample) ParseFilename() {
 			s.Key = key.Of(opiece)
 			if s.Key.Root != 0 {
 				keyFound = true
+				s.KeySource = FromFilename
 				// go Library.IngestKey(s)
 			}
 		}
 	}
+	if s.Tempo != 0 {
+		s.TempoSource = FromFilename
+		s.TempoCandidates = appendTempo(s.TempoCandidates, s.Tempo)
+	}
 	if !keyFound && fallback != "" {
-		log.Warn().Msgf("using fallback key for %s: %s", s.Name, fallback)
+		slog.Warn().Str("attribute", "key").Str("source", FromFilename).Msgf("using fallback key %s", fallback)
+		Run.FallbackKey(s.Path, fallback)
 		s.Key = key.Of(fallback)
+		s.KeySource = FromFilename
 		// go Library.IngestKey(s)
 	}
 }
@@ -276,6 +281,7 @@ func readWAV(s *Sample) error {
 	}
 	defer f.Close()
 
+	slog := log.With().Str("path", s.Path).Str("phase", PhaseAnalysis).Logger()
 	decoder := wav.NewDecoder(f)
 
 	decoder.ReadMetadata()
@@ -289,10 +295,10 @@ func readWAV(s *Sample) error {
 
 	s.Duration, err = decoder.Duration()
 	if err != nil {
-		log.Warn().Caller().Str("caller", s.Name).Err(err).Msg("failed to get duration")
+		slog.Warn().Caller().Err(err).Msg("failed to get duration")
 	}
 
-	log.Debug().Caller().Str("caller", s.Name).Msgf("duration: %s", s.Duration.String())
+	slog.Debug().Caller().Msgf("duration: %s", s.Duration.String())
 
 	isLoop := false
 
@@ -308,7 +314,7 @@ func readWAV(s *Sample) error {
 	}
 
 	if s.Metadata == nil {
-		log.Debug().Caller().Str("caller", s.Name).Msg("no metadata found")
+		slog.Debug().Caller().Msg("no metadata found")
 		return nil
 	}
 
@@ -317,33 +323,55 @@ func readWAV(s *Sample) error {
 		s.Types[TypeLoop] = struct{}{}
 	}
 
-	log.Trace().Msg(fmt.Sprintf("metadata: %v", s.Metadata))
+	slog.Trace().Msg(fmt.Sprintf("metadata: %v", s.Metadata))
 
 	// Acoustic verification: override filename guesses with measured audio data
 	if !config.SkipWavDecode {
 		if buf, pcmErr := decoder.FullPCMBuffer(); pcmErr == nil && buf != nil {
 			mono := toMonoFloat32(buf)
 			sr := int(buf.Format.SampleRate)
+			if config.Thumbnails && !config.Simulate {
+				if err := s.renderThumbnails(mono, sr); err != nil {
+					slog.Warn().Str("phase", PhaseThumbnails).Err(err).Msg("failed to render thumbnails")
+				}
+			}
 			// BPM
-			bpm := analysis.DetectBPM(mono, sr)
+			bpm, confidence := analysis.DetectTempo(mono, sr)
 			if bpm >= 50 && bpm <= 250 {
 				acousticTempo := int(math.Round(bpm))
+				s.TempoCandidates = appendTempo(s.TempoCandidates, acousticTempo)
+				s.TempoSource = FromAudio
 				if s.Tempo == 0 {
 					s.Tempo = acousticTempo
 				} else if s.Tempo != acousticTempo {
-					log.Warn().Str("caller", s.Name).Msgf("BPM mismatch: filename=%d acoustic=%d, trusting acoustic", s.Tempo, acousticTempo)
+					slog.Warn().Str("attribute", "tempo").Str("source", FromAudio).Float64("confidence", confidence).
+						Msgf("BPM mismatch: filename=%d acoustic=%d, trusting acoustic", s.Tempo, acousticTempo)
+					Run.Mismatch(Mismatch{
+						Path: s.Path, Attribute: "tempo", Filename: strconv.Itoa(s.Tempo),
+						Acoustic: strconv.Itoa(acousticTempo), Confidence: confidence,
+					})
 					s.Tempo = acousticTempo
 				}
 			}
 			// Key — skip one-shots, too short for reliable detection
 			if _, isOneShot := s.Types[TypeOneShot]; !isOneShot {
-				detectedKey, _ := analysis.DetectKey(mono, sr, float64(config.AnalyzeSeconds))
+				chroma := analysis.ComputeChroma(mono, sr, float64(config.AnalyzeSeconds))
+				guess := analysis.EstimateKeyFromChroma(chroma)
+				detectedKey := guess.Best.Key
+				s.KeyCandidates = guess.Candidates
+				s.Chroma = normalizeChroma(chroma)
 				if detectedKey.Root != 0 || detectedKey.Mode != 0 {
+					s.KeySource = FromAudio
 					if s.Key.Root == 0 {
 						s.Key = detectedKey
 					} else if s.Key != detectedKey {
-						log.Warn().Str("caller", s.Name).Msgf("key mismatch: filename=%s acoustic=%s, trusting acoustic",
-							s.Key.Root.String(s.Key.AdjSymbol), detectedKey.Root.String(detectedKey.AdjSymbol))
+						slog.Warn().Str("attribute", "key").Str("source", FromAudio).Float64("confidence", guess.Best.Score).
+							Msgf("key mismatch: filename=%s acoustic=%s, trusting acoustic",
+								s.Key.Root.String(s.Key.AdjSymbol), detectedKey.Root.String(detectedKey.AdjSymbol))
+						Run.Mismatch(Mismatch{
+							Path: s.Path, Attribute: "key", Filename: keyName(s.Key),
+							Acoustic: keyName(detectedKey), Confidence: guess.Best.Score,
+						})
 						s.Key = detectedKey
 					}
 				}
@@ -356,8 +384,9 @@ func readWAV(s *Sample) error {
 	return nil
 }
 
-func Process(entry fs.DirEntry, dir string) (*Sample, error) {
-	log.Trace().Str("caller", entry.Name()).Msg("Processing")
+// Process analyzes the file at dir, found under the source root labeled root, and ingests it into Library.
+func Process(entry fs.DirEntry, dir string, root string) (*Sample, error) {
+	log.Trace().Str("path", dir).Str("phase", PhaseAnalysis).Msg("Processing")
 	var finfo os.FileInfo
 	var err error
 	finfo, err = entry.Info()
@@ -373,27 +402,20 @@ func Process(entry fs.DirEntry, dir string) (*Sample, error) {
 		Path:    dir,
 		ModTime: finfo.ModTime(),
 		Types:   make(map[SampleType]struct{}),
+		Root:    root,
 	}
 
 	s.ParseFilename()
-	defer Library.IngestSample(s)
 
 	switch ext {
 	case "midi", "mid":
 		if !config.NoMIDI {
 			s.Types[TypeMIDI] = struct{}{}
-			// Parse MIDI meta events for tempo and key
-			if midiTempo, midiKey, midiErr := parseMIDI(s.Path); midiErr == nil {
-				if midiTempo > 0 && s.Tempo == 0 {
-					s.Tempo = midiTempo
-				}
-				if midiKey.Root != 0 && s.Key.Root == 0 {
-					s.Key = midiKey
-				}
+			if midi, midiErr := parseMIDI(s.Path); midiErr == nil {
+				s.applyMIDI(midi)
 			} else {
-				log.Debug().Str("caller", s.Name).Err(midiErr).Msg("failed to parse MIDI meta events")
+				log.Debug().Str("path", s.Path).Str("phase", PhaseAnalysis).Err(midiErr).Msg("failed to parse MIDI")
 			}
-			Library.IngestMIDI(s)
 		}
 
 	case "wav":
@@ -402,8 +424,13 @@ func Process(entry fs.DirEntry, dir string) (*Sample, error) {
 		}
 		wavErr := readWAV(s)
 		if wavErr != nil {
-			log.Debug().Caller().Str("caller", s.Name).Msgf("failed to parse wav data: %s", wavErr.Error())
-			return nil, nil
+			return nil, fmt.Errorf("failed to parse wav data: %w", wavErr)
+		}
+		if config.Thumbnails && !config.Simulate {
+			// usually rendered from the PCM analysis decoded already, not when it didn't run
+			if _, err := s.Thumbnails(); err != nil {
+				log.Warn().Str("path", s.Path).Str("phase", PhaseThumbnails).Err(err).Msg("failed to render thumbnails")
+			}
 		}
 		if s.Metadata == nil {
 			break
@@ -413,6 +440,17 @@ func Process(entry fs.DirEntry, dir string) (*Sample, error) {
 		return nil, nil
 	}
 
+	if fi, serr := os.Stat(s.Path); serr == nil {
+		s.Size = fi.Size()
+	}
+	// only the start of the file, which reading its header just brought into the page cache
+	if s.Fingerprint, err = util.Fingerprint(s.Path); err != nil {
+		log.Debug().Str("path", s.Path).Str("phase", PhaseAnalysis).Err(err).Msg("failed to fingerprint")
+		err = nil
+	}
+
+	Library.IngestSample(s)
+
 	return s, err
 }
 
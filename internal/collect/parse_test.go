@@ -203,6 +203,7 @@ func newTestLibrary() *Collection {
 		CreationDates: make(map[string][]*Sample),
 		Arists:        make(map[string][]*Sample),
 		Software:      make(map[string][]*Sample),
+		Roots:         make(map[string][]*Sample),
 		mu:            &sync.RWMutex{},
 	}
 }
@@ -0,0 +1,172 @@
+package collect
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"math"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"git.tcp.direct/kayos/keepr/internal/config"
+	"git.tcp.direct/kayos/keepr/internal/util"
+)
+
+// PlaylistFormats are the playlist formats WritePlaylists knows.
+var PlaylistFormats = []string{"m3u8", "xspf"}
+
+// playlistEntry is a sample as it appears in a playlist.
+type playlistEntry struct {
+	location string
+	title    string
+	artist   string
+	// seconds is -1 when the duration is unknown, as extended M3U has it.
+	seconds float64
+}
+
+// WritePlaylists writes a playlist per view and format under dir, e.g. dir/Key/A_Minor.m3u8 for
+// the Key/A_Minor view. Entries point at the original samples, relative to the playlist with --relative.
+func (c *Collection) WritePlaylists(dir string, formats []string) (written int, err error) {
+	for _, format := range formats {
+		if format != "m3u8" && format != "xspf" {
+			return 0, fmt.Errorf("unknown playlist format %q, want one of %s", format, strings.Join(PlaylistFormats, ", "))
+		}
+	}
+	for view, samples := range c.Views() {
+		for _, format := range formats {
+			path := filepath.Join(dir, filepath.FromSlash(view)) + "." + format
+			data := renderPlaylist(format, view, playlistEntries(samples, path))
+			if config.Simulate {
+				log.Printf("would have written playlist %s", path)
+				continue
+			}
+			if err = os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+				return written, err
+			}
+			if err = os.WriteFile(path, data, 0o644); err != nil {
+				return written, err
+			}
+			written++
+		}
+	}
+	return written, nil
+}
+
+// DropPlaylists removes the playlists under dir of the views old had and next doesn't, those left
+// behind by WritePlaylists when a view empties. It returns how many it removed.
+func DropPlaylists(old, next *Collection, dir string, formats []string) (removed int) {
+	after := next.Views()
+	for view := range old.Views() {
+		if _, ok := after[view]; ok {
+			continue
+		}
+		for _, format := range formats {
+			path := filepath.Join(dir, filepath.FromSlash(view)) + "." + format
+			if config.Simulate {
+				log.Printf("would have removed playlist %s", path)
+				continue
+			}
+			if err := os.Remove(path); err != nil {
+				if !os.IsNotExist(err) {
+					log.Warn().Str("path", path).Err(err).Msg("failed to remove playlist")
+				}
+				continue
+			}
+			removed++
+			// only succeeds once nothing else is in there
+			_ = os.Remove(filepath.Dir(path))
+		}
+	}
+	return removed
+}
+
+// playlistEntries sorts samples by name and resolves where the playlist at path finds them.
+func playlistEntries(samples []*Sample, path string) []playlistEntry {
+	sorted := append([]*Sample(nil), samples...)
+	sort.SliceStable(sorted, func(i, j int) bool { return strings.ToLower(sorted[i].Name) < strings.ToLower(sorted[j].Name) })
+	entries := make([]playlistEntry, 0, len(sorted))
+	seen := make(map[string]struct{})
+	for _, s := range sorted {
+		if _, dup := seen[s.Path]; dup {
+			continue
+		}
+		seen[s.Path] = struct{}{}
+		location, err := util.LinkTarget(s.Path, path, config.Relative)
+		if err != nil {
+			log.Warn().Str("path", s.Path).Err(err).Msg("falling back to absolute path in playlist")
+		}
+		e := playlistEntry{location: location, title: strings.TrimSuffix(s.Name, filepath.Ext(s.Name)), seconds: -1}
+		if s.Metadata != nil {
+			if s.Metadata.Title != "" {
+				e.title = s.Metadata.Title
+			}
+			e.artist = s.Metadata.Artist
+		}
+		if s.Duration > 0 {
+			e.seconds = s.Duration.Seconds()
+		}
+		entries = append(entries, e)
+	}
+	return entries
+}
+
+func renderPlaylist(format, title string, entries []playlistEntry) []byte {
+	if format == "xspf" {
+		return renderXSPF(title, entries)
+	}
+	return renderM3U8(title, entries)
+}
+
+// renderM3U8 writes extended M3U, durations in whole seconds.
+func renderM3U8(title string, entries []playlistEntry) []byte {
+	var b bytes.Buffer
+	b.WriteString("#EXTM3U\n#PLAYLIST:" + title + "\n")
+	for _, e := range entries {
+		name := e.title
+		if e.artist != "" {
+			name = e.artist + " - " + name
+		}
+		seconds := -1
+		if e.seconds >= 0 {
+			seconds = int(math.Ceil(e.seconds))
+		}
+		fmt.Fprintf(&b, "#EXTINF:%d,%s\n%s\n", seconds, name, filepath.ToSlash(e.location))
+	}
+	return b.Bytes()
+}
+
+type xspfTrack struct {
+	Location string `xml:"location"`
+	Title    string `xml:"title,omitempty"`
+	Creator  string `xml:"creator,omitempty"`
+	// Duration is in milliseconds.
+	Duration int64 `xml:"duration,omitempty"`
+}
+
+type xspfPlaylist struct {
+	XMLName xml.Name    `xml:"http://xspf.org/ns/0/ playlist"`
+	Version int         `xml:"version,attr"`
+	Title   string      `xml:"title"`
+	Tracks  []xspfTrack `xml:"trackList>track"`
+}
+
+// renderXSPF writes an XSPF playlist, locations are file URIs or relative URI references.
+func renderXSPF(title string, entries []playlistEntry) []byte {
+	pl := xspfPlaylist{Version: 1, Title: title, Tracks: make([]xspfTrack, 0, len(entries))}
+	for _, e := range entries {
+		loc := &url.URL{Path: filepath.ToSlash(e.location)}
+		if filepath.IsAbs(e.location) {
+			loc.Scheme = "file"
+		}
+		t := xspfTrack{Location: loc.String(), Title: e.title, Creator: e.artist}
+		if e.seconds >= 0 {
+			t.Duration = int64(math.Round(e.seconds * 1000))
+		}
+		pl.Tracks = append(pl.Tracks, t)
+	}
+	data, _ := xml.MarshalIndent(pl, "", "  ")
+	return append([]byte(xml.Header), append(data, '\n')...)
+}
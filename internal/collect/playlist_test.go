@@ -0,0 +1,80 @@
+package collect
+
+import (
+	"encoding/xml"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-audio/wav"
+	"gopkg.in/music-theory.v0/key"
+
+	"git.tcp.direct/kayos/keepr/internal/config"
+)
+
+func TestWritePlaylists(t *testing.T) {
+	dir := t.TempDir()
+	c := NewCollection()
+	c.IngestSample(&Sample{
+		Name: "pad loop.wav", Path: "/src/pad loop.wav", Key: key.Of("Am"), Duration: 2500 * time.Millisecond,
+		Types:    map[SampleType]struct{}{TypeLoop: {}},
+		Metadata: &wav.Metadata{Artist: "Someone", Title: "Pad"},
+	})
+	c.IngestSample(&Sample{Name: "arp.wav", Path: "/src/arp.wav", Key: key.Of("Am"), Types: map[SampleType]struct{}{}})
+
+	written, err := c.WritePlaylists(dir, []string{"m3u8", "xspf"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if written != 4 { // Key/A_Minor and Artists/Someone
+		t.Errorf("wrote %d playlists, want 4", written)
+	}
+	m3u, err := os.ReadFile(filepath.Join(dir, "Key", "A_Minor.m3u8"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "#EXTM3U\n#PLAYLIST:Key/A_Minor\n#EXTINF:-1,arp\n/src/arp.wav\n#EXTINF:3,Someone - Pad\n/src/pad loop.wav\n"
+	if string(m3u) != want {
+		t.Errorf("m3u8 =\n%s\nwant\n%s", m3u, want)
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, "Key", "A_Minor.xspf"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var pl xspfPlaylist
+	if err = xml.Unmarshal(data, &pl); err != nil {
+		t.Fatal(err)
+	}
+	if len(pl.Tracks) != 2 || pl.Tracks[1].Location != "file:///src/pad%20loop.wav" || pl.Tracks[1].Duration != 2500 {
+		t.Errorf("xspf tracks = %+v", pl.Tracks)
+	}
+
+	config.Relative = true
+	defer func() { config.Relative = false }()
+	if _, err = c.WritePlaylists(dir, []string{"m3u8"}); err != nil {
+		t.Fatal(err)
+	}
+	m3u, _ = os.ReadFile(filepath.Join(dir, "Key", "A_Minor.m3u8"))
+	rel, _ := filepath.Rel(filepath.Join(dir, "Key"), "/src/arp.wav")
+	if !strings.Contains(string(m3u), "\n"+filepath.ToSlash(rel)+"\n") {
+		t.Errorf("relative m3u8 =\n%s\nwant a line %s", m3u, rel)
+	}
+
+	if _, err = c.WritePlaylists(dir, []string{"pls"}); err == nil {
+		t.Error("unknown format should fail")
+	}
+
+	next := c.Without(func(s *Sample) bool { return s.Name == "pad loop.wav" })
+	if n := DropPlaylists(c, next, dir, []string{"m3u8", "xspf"}); n != 2 {
+		t.Errorf("dropped %d playlists, want Artists/Someone's 2", n)
+	}
+	if _, err = os.Stat(filepath.Join(dir, "Artists")); !os.IsNotExist(err) {
+		t.Errorf("emptied Artists is still there: %v", err)
+	}
+	if _, err = os.Stat(filepath.Join(dir, "Key", "A_Minor.m3u8")); err != nil {
+		t.Error(err)
+	}
+}
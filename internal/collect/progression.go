@@ -0,0 +1,219 @@
+package collect
+
+import (
+	"strings"
+
+	"gopkg.in/music-theory.v0/chord"
+	"gopkg.in/music-theory.v0/key"
+	"gopkg.in/music-theory.v0/note"
+)
+
+// Progression is the chord progression of a MIDI file, a repeating pattern is only listed once.
+type Progression struct {
+	// Chords are chord names, e.g. "Am", "F", "C", "G".
+	Chords []string
+	// Numerals are the same chords as roman numerals relative to the sample's key, e.g. "i", "VI", "III", "VII".
+	// Empty when the key is unknown.
+	Numerals []string
+}
+
+// String returns the numerals joined with dashes, or the chord names if there are no numerals.
+func (p *Progression) String() string {
+	if len(p.Numerals) > 0 {
+		return strings.Join(p.Numerals, "-")
+	}
+	return strings.Join(p.Chords, "-")
+}
+
+// progressionDirChords is how many chords of a progression name its view directory, so that long
+// ones don't make names longer than filesystems allow.
+const progressionDirChords = 8
+
+// Dir names p's directory in the MIDI/Progressions view, String cut short after progressionDirChords
+// chords.
+func (p *Progression) Dir() string {
+	names := p.Numerals
+	if len(names) == 0 {
+		names = p.Chords
+	}
+	if len(names) <= progressionDirChords {
+		return p.String()
+	}
+	return strings.Join(names[:progressionDirChords], "-") + "-..."
+}
+
+// chordForm is a chord quality we recognize, in order of preference when several fit equally well.
+type chordForm struct {
+	suffix string
+	minor  bool
+	// numeral is appended to the roman numeral, e.g. "7" or "°".
+	numeral string
+	// tones are pitch classes above the root.
+	tones []int
+}
+
+// chordForms are built from the music-theory chord parser, sus2 and power chords are left out because it reads them wrong.
+var chordForms = func() []chordForm {
+	forms := []struct {
+		suffix, numeral string
+		minor           bool
+	}{
+		{"", "", false}, {"m", "", true}, {"7", "7", false}, {"maj7", "maj7", false}, {"m7", "7", true},
+		{"dim", "°", true}, {"m7b5", "ø7", true}, {"dim7", "°7", true}, {"aug", "+", false},
+		{"sus4", "sus4", false}, {"6", "6", false}, {"m6", "6", true}, {"add9", "add9", false},
+	}
+	var out []chordForm
+	for _, f := range forms {
+		c := chord.Of("C" + f.suffix)
+		cf := chordForm{suffix: f.suffix, minor: f.minor, numeral: f.numeral}
+		for _, class := range c.Tones {
+			cf.tones = append(cf.tones, pitchClass(class))
+		}
+		out = append(out, cf)
+	}
+	return out
+}()
+
+// pitchClass converts a music-theory note class to a pitch class counted from C = 0.
+func pitchClass(c note.Class) int {
+	return (int(c) - int(note.C) + 12) % 12
+}
+
+// numerals for each semitone above the key's root, as steps of the mode's own scale.
+var (
+	majorNumerals = []string{"I", "bII", "II", "bIII", "III", "IV", "#IV", "V", "bVI", "VI", "bVII", "VII"}
+	minorNumerals = []string{"I", "bII", "II", "III", "#III", "IV", "bV", "V", "VI", "#VI", "VII", "#VII"}
+)
+
+// recognizedChord is a chord found in a slice of time.
+type recognizedChord struct {
+	root int
+	form *chordForm
+}
+
+// minChordScore is how well a slice has to fit a chord for us to name it.
+const minChordScore = 0.4
+
+// recognizeChord names the chord in a slice of time from how long each pitch class sounds in it
+// and the lowest pitch class, or returns nil if it isn't a chord.
+func recognizeChord(weights [12]float64, bass int) *recognizedChord {
+	var total float64
+	distinct := 0
+	for _, w := range weights {
+		total += w
+		if w > 0 {
+			distinct++
+		}
+	}
+	if distinct < 3 {
+		return nil
+	}
+	var best *recognizedChord
+	bestScore := minChordScore
+	for i := range chordForms {
+		f := &chordForms[i]
+		for root := 0; root < 12; root++ {
+			var in, missing float64
+			for _, t := range f.tones {
+				pc := (root + t) % 12
+				if weights[pc] == 0 {
+					missing++
+				}
+				in += weights[pc]
+			}
+			score := (2*in-total)/total - 0.15*missing
+			if bass == root {
+				score += 0.1
+			}
+			if score > bestScore {
+				best, bestScore = &recognizedChord{root: root, form: f}, score
+			}
+		}
+	}
+	return best
+}
+
+// progression recognizes a chord in every beat of the file and names the changes relative to k,
+// returning nil if there aren't at least two different chords.
+func (m *midiFile) progression(k key.Key) *Progression {
+	beat := m.ticksPerBeat()
+	if beat == 0 || m.Length == 0 {
+		return nil
+	}
+	var steps []recognizedChord
+	for start := uint64(0); start < m.Length; start += beat {
+		end := start + beat
+		var weights [12]float64
+		bass, low := -1, 128
+		for _, n := range m.Notes {
+			if n.Channel == midiDrumChannel || n.Start >= end || n.Start+n.Duration <= start {
+				continue
+			}
+			from, to := n.Start, n.Start+n.Duration
+			if from < start {
+				from = start
+			}
+			if to > end {
+				to = end
+			}
+			weights[n.Pitch%12] += float64(to-from) + 1
+			if int(n.Pitch) < low {
+				low, bass = int(n.Pitch), int(n.Pitch%12)
+			}
+		}
+		c := recognizeChord(weights, bass)
+		if c == nil {
+			continue
+		}
+		if last := len(steps) - 1; last >= 0 && steps[last] == *c {
+			continue
+		}
+		steps = append(steps, *c)
+	}
+	steps = shortestCycle(steps)
+	if len(steps) < 2 {
+		return nil
+	}
+
+	adj := k.AdjSymbol
+	if k.Root == 0 {
+		adj = note.Sharp
+	}
+	p := &Progression{}
+	for _, c := range steps {
+		root, _ := note.C.Step(c.root)
+		p.Chords = append(p.Chords, root.String(adj)+c.form.suffix)
+	}
+	if k.Root != 0 {
+		numerals := majorNumerals
+		if k.Mode == key.Minor {
+			numerals = minorNumerals
+		}
+		for _, c := range steps {
+			numeral := numerals[(c.root-pitchClass(k.Root)+12)%12]
+			if c.form.minor {
+				numeral = strings.ToLower(numeral)
+			}
+			p.Numerals = append(p.Numerals, numeral+c.form.numeral)
+		}
+	}
+	return p
+}
+
+// shortestCycle returns the shortest run of steps that repeats to make up all of them, so a four chord
+// loop played four times is still four chords. The last repeat may be cut short, A B A B A is A B.
+func shortestCycle(steps []recognizedChord) []recognizedChord {
+	for n := 1; n < len(steps); n++ {
+		repeats := true
+		for i := n; i < len(steps); i++ {
+			if steps[i] != steps[i%n] {
+				repeats = false
+				break
+			}
+		}
+		if repeats {
+			return steps[:n]
+		}
+	}
+	return steps
+}
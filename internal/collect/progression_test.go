@@ -0,0 +1,93 @@
+package collect
+
+import (
+	"reflect"
+	"testing"
+
+	"gopkg.in/music-theory.v0/key"
+)
+
+// block returns a chord held for a bar of 4/4 at 96 ticks per quarter note.
+func block(bar uint64, pitches ...uint8) []midiNote {
+	var notes []midiNote
+	for _, p := range pitches {
+		notes = append(notes, midiNote{Pitch: p, Velocity: 100, Start: bar * 384, Duration: 384})
+	}
+	return notes
+}
+
+func TestMIDIFile_Progression(t *testing.T) {
+	var notes []midiNote
+	for loop := uint64(0); loop < 2; loop++ {
+		notes = append(notes, block(loop*4, 45, 60, 64, 69)...)   // Am over A
+		notes = append(notes, block(loop*4+1, 41, 60, 65, 69)...) // F
+		notes = append(notes, block(loop*4+2, 48, 60, 64, 67)...) // C
+		notes = append(notes, block(loop*4+3, 43, 62, 67, 71)...) // G
+	}
+	m := &midiFile{Division: 96, Notes: notes, Length: 8 * 384}
+	if kind := m.kind(); kind != MIDIChords {
+		t.Fatalf("kind() = %s, want chords", kind)
+	}
+
+	got := m.progression(key.Of("A minor"))
+	want := &Progression{Chords: []string{"Am", "F", "C", "G"}, Numerals: []string{"i", "VI", "III", "VII"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("progression() = %+v, want %+v", got, want)
+	}
+	if got.String() != "i-VI-III-VII" {
+		t.Errorf("String() = %q", got.String())
+	}
+
+	got = m.progression(key.Of("C major"))
+	if want := []string{"vi", "IV", "I", "V"}; !reflect.DeepEqual(got.Numerals, want) {
+		t.Errorf("in C major, Numerals = %v, want %v", got.Numerals, want)
+	}
+
+	if got = m.progression(key.Key{}); got.Numerals != nil || got.String() != "Am-F-C-G" {
+		t.Errorf("without a key, progression() = %+v", got)
+	}
+	if dir := got.Dir(); dir != "Am-F-C-G" {
+		t.Errorf("Dir() = %q", dir)
+	}
+
+	long := &Progression{}
+	for i := 0; i < 100; i++ {
+		long.Chords = append(long.Chords, "C#m7b5")
+		long.Numerals = append(long.Numerals, "ii°7")
+	}
+	if dir := long.Dir(); dir != "ii°7-ii°7-ii°7-ii°7-ii°7-ii°7-ii°7-ii°7-..." {
+		t.Errorf("Dir() of a long progression = %q", dir)
+	}
+}
+
+func TestRecognizeChord(t *testing.T) {
+	weigh := func(pcs ...int) [12]float64 {
+		var w [12]float64
+		for _, pc := range pcs {
+			w[pc] = 1
+		}
+		return w
+	}
+	tests := []struct {
+		name    string
+		weights [12]float64
+		bass    int
+		want    string
+	}{
+		{"G7", weigh(7, 11, 2, 5), 7, "7"},
+		{"Bdim", weigh(11, 2, 5), 11, "dim"},
+		{"Cmaj7", weigh(0, 4, 7, 11), 0, "maj7"},
+		{"two notes", weigh(0, 7), 0, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := recognizeChord(tt.weights, tt.bass)
+			switch {
+			case tt.want == "" && c != nil:
+				t.Errorf("recognizeChord() = %+v, want nothing", c)
+			case tt.want != "" && (c == nil || c.root != tt.bass || c.form.suffix != tt.want):
+				t.Errorf("recognizeChord() = %+v, want a %s chord on %d", c, tt.want, tt.bass)
+			}
+		})
+	}
+}
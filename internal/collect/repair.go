@@ -0,0 +1,154 @@
+package collect
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"git.tcp.direct/kayos/keepr/internal/config"
+	"git.tcp.direct/kayos/keepr/internal/util"
+)
+
+// Missing returns the samples whose files are gone.
+func (c *Collection) Missing() []*Sample {
+	return c.Filter(func(s *Sample) bool {
+		_, err := os.Stat(s.Path)
+		return err != nil
+	})
+}
+
+// Relocate looks for the files of missing samples under roots, matching them by size and fingerprint,
+// or by size and name for samples cataloged without a fingerprint, and points the samples at where
+// they were found. Only files of a missing sample's size get fingerprinted. skip filters what is
+// looked at, as the source roots' filters do for scan. It returns the old path of every relocated
+// sample. c's view maps still hold the samples under their old source root labels, ingest them into
+// a new Collection to sort them out.
+func (c *Collection) Relocate(missing []*Sample, roots []*config.SourceRoot, skip func(root *config.SourceRoot, rel string, isDir bool) bool) map[*Sample]string {
+	bySize := make(map[int64][]*Sample)
+	for _, s := range missing {
+		if s.Size > 0 {
+			bySize[s.Size] = append(bySize[s.Size], s)
+		}
+	}
+	outputs := Generations(config.Output)
+	cataloged := make(map[string]struct{}, len(c.Samples))
+	for _, s := range c.Samples {
+		cataloged[s.Path] = struct{}{}
+	}
+
+	type found struct {
+		path string
+		root *config.SourceRoot
+	}
+	// every match of each sample, a file by the sample's name first
+	matches := make(map[*Sample][]found)
+	for _, root := range roots {
+		root := root
+		err := filepath.WalkDir(root.Path, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				log.Warn().Str("path", path).Err(err).Msg("can't look here")
+				return nil
+			}
+			rel, _ := filepath.Rel(root.Path, path)
+			if rel != "." && skip(root, filepath.ToSlash(rel), d.IsDir()) || underAny(path, outputs) {
+				if d.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if !d.Type().IsRegular() {
+				return nil
+			}
+			if _, ok := cataloged[path]; ok {
+				return nil
+			}
+			fi, err := d.Info()
+			if err != nil {
+				return nil
+			}
+			var fingerprint string
+			for _, s := range bySize[fi.Size()] {
+				if s.Fingerprint == "" {
+					if d.Name() != s.Name {
+						continue
+					}
+				} else {
+					if fingerprint == "" {
+						if fingerprint, err = util.Fingerprint(path); err != nil {
+							log.Warn().Str("path", path).Err(err).Msg("failed to fingerprint")
+							return nil
+						}
+					}
+					if fingerprint != s.Fingerprint {
+						continue
+					}
+				}
+				f := found{path, root}
+				if d.Name() == s.Name {
+					matches[s] = append([]found{f}, matches[s]...)
+				} else {
+					matches[s] = append(matches[s], f)
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			log.Warn().Str("path", root.Path).Err(err).Msg("failed to search source root")
+		}
+	}
+
+	moved := make(map[*Sample]string, len(matches))
+	taken := make(map[string]struct{})
+	for _, s := range missing {
+		for _, f := range matches[s] {
+			if _, ok := taken[f.path]; ok {
+				// identical files that went missing together each get one of the copies found
+				continue
+			}
+			taken[f.path] = struct{}{}
+			moved[s] = s.Path
+			s.Path, s.Root = f.path, f.root.Label
+			if fi, err := os.Stat(f.path); err == nil {
+				s.ModTime = fi.ModTime()
+			}
+			break
+		}
+	}
+	return moved
+}
+
+func underAny(path string, dirs []string) bool {
+	for _, dir := range dirs {
+		if Under(path, dir) {
+			return true
+		}
+	}
+	return false
+}
+
+// Relink points the view entries of the moved samples at their new paths, c being the collection
+// they were ingested into after Relocate and old the one they were relocated in. Entries of views
+// the samples left, such as their old source root's, are removed, and links are made in the
+// background like SyncLinks does. It returns how many entries were replaced or added.
+func (c *Collection) Relink(old *Collection, moved map[*Sample]string) int {
+	// SyncLinks takes care of the views the samples joined or left
+	n, _ := SyncLinks(old, c)
+	before := old.Views()
+	for view, ss := range c.Views() {
+		had := make(map[*Sample]struct{}, len(before[view]))
+		for _, s := range before[view] {
+			had[s] = struct{}{}
+		}
+		dir := util.APath(filepath.Join(config.Output, filepath.FromSlash(view)))
+		for _, s := range ss {
+			if _, ok := moved[s]; !ok {
+				continue
+			}
+			if _, ok := had[s]; ok {
+				spawnLink(s, dir)
+				n++
+			}
+		}
+	}
+	return n
+}
@@ -0,0 +1,263 @@
+package collect
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Run is the report of the current run, scan and link only fill it in when it isn't nil.
+var Run *Report
+
+// Report sums up what a run did, and what it found questionable, so that it doesn't have to be dug
+// out of the log afterwards.
+type Report struct {
+	mu sync.Mutex
+	// Command is the keepr command that ran, "" being scan and link in one go.
+	Command  string    `json:"command"`
+	Started  time.Time `json:"started"`
+	Finished time.Time `json:"finished"`
+	// Processed is how many files were analyzed and cataloged.
+	Processed int `json:"processed"`
+	// Skipped and Failed count the files that weren't, by reason.
+	Skipped map[string]int `json:"skipped"`
+	Failed  map[string]int `json:"failed"`
+	// Failures are the files that failed and why.
+	Failures []Failure `json:"failures,omitempty"`
+	// Mismatches are the files whose name says one thing and whose audio another.
+	Mismatches []Mismatch `json:"mismatches,omitempty"`
+	// FallbackKeys are the files whose key was guessed from a lone note name in their name.
+	FallbackKeys []FallbackKey `json:"fallback_keys,omitempty"`
+	// Unclassified are the cataloged files that ended up in no tempo, key, drum, loop or MIDI view.
+	Unclassified []string `json:"unclassified,omitempty"`
+	Phases       []Phase  `json:"phases"`
+}
+
+// Failure is a file that couldn't be processed.
+type Failure struct {
+	Path   string `json:"path"`
+	Reason string `json:"reason"`
+	Error  string `json:"error"`
+}
+
+// Mismatch is an attribute a file's name and its audio disagree about. The audio wins.
+type Mismatch struct {
+	Path      string `json:"path"`
+	Attribute string `json:"attribute"`
+	Filename  string `json:"filename"`
+	Acoustic  string `json:"acoustic"`
+	// Confidence is how sure the acoustic analysis is, see analysis.DetectTempo and analysis.KeyGuess.
+	Confidence float64 `json:"confidence"`
+}
+
+// FallbackKey is a key taken from a lone note name, e.g. the "A" of "pad_A_01.wav".
+type FallbackKey struct {
+	Path string `json:"path"`
+	Key  string `json:"key"`
+}
+
+// Phase is how long a part of the run took.
+type Phase struct {
+	Name    string  `json:"name"`
+	Seconds float64 `json:"seconds"`
+}
+
+// NewReport starts the report of a run of command.
+func NewReport(command string) *Report {
+	return &Report{
+		Command: command,
+		Started: time.Now(),
+		Skipped: make(map[string]int),
+		Failed:  make(map[string]int),
+	}
+}
+
+// AddProcessed counts a file as cataloged.
+func (r *Report) AddProcessed() {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	r.Processed++
+	r.mu.Unlock()
+}
+
+// Skip counts a file as skipped for reason.
+func (r *Report) Skip(reason string) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	r.Skipped[reason]++
+	r.mu.Unlock()
+}
+
+// Fail records that the file at path failed for reason.
+func (r *Report) Fail(path, reason string, err error) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	r.Failed[reason]++
+	r.Failures = append(r.Failures, Failure{Path: path, Reason: reason, Error: err.Error()})
+	r.mu.Unlock()
+}
+
+// Mismatch records a disagreement between a file's name and its audio.
+func (r *Report) Mismatch(m Mismatch) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	r.Mismatches = append(r.Mismatches, m)
+	r.mu.Unlock()
+}
+
+// FallbackKey records a key taken from a lone note name.
+func (r *Report) FallbackKey(path, key string) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	r.FallbackKeys = append(r.FallbackKeys, FallbackKey{Path: path, Key: key})
+	r.mu.Unlock()
+}
+
+// Phase starts timing the phase called name, the returned function ends it.
+func (r *Report) Phase(name string) func() {
+	if r == nil {
+		return func() {}
+	}
+	start := time.Now()
+	return func() {
+		r.mu.Lock()
+		r.Phases = append(r.Phases, Phase{Name: name, Seconds: time.Since(start).Seconds()})
+		r.mu.Unlock()
+	}
+}
+
+// Finish ends the run, listing the samples of c that weren't classified.
+func (r *Report) Finish(c *Collection) {
+	if r == nil {
+		return
+	}
+	classified := make(map[*Sample]struct{})
+	for view, samples := range c.Views() {
+		top := strings.SplitN(view, "/", 2)[0]
+		if top != "Tempo" && top != "Key" && top != "Drums" && top != "Melodic Loops" && (top != "MIDI" || view == "MIDI/All") {
+			continue
+		}
+		for _, s := range samples {
+			classified[s] = struct{}{}
+		}
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.Unclassified = r.Unclassified[:0]
+	for _, s := range c.Filter(func(s *Sample) bool { _, ok := classified[s]; return !ok }) {
+		r.Unclassified = append(r.Unclassified, s.Path)
+	}
+	sort.Strings(r.Unclassified)
+	r.Finished = time.Now()
+}
+
+// Save writes r to path as JSON.
+func (r *Report) Save(path string) error {
+	if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	data, err := json.MarshalIndent(r, "", "  ")
+	r.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0o644)
+}
+
+// LoadReport reads a report saved with Save.
+func LoadReport(path string) (*Report, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	r := new(Report)
+	if err = json.Unmarshal(data, r); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return r, nil
+}
+
+// WriteSummary writes a human readable summary of r to w, listing at most limit of each kind of file
+// worth a look, all of them if limit is 0.
+func (r *Report) WriteSummary(w io.Writer, limit int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	b := new(strings.Builder)
+	command := r.Command
+	if command == "" {
+		command = "scan and link"
+	}
+	fmt.Fprintf(b, "%s, %s, took %s\n", command, r.Started.Format(time.RFC3339), r.Finished.Sub(r.Started).Round(time.Millisecond))
+	fmt.Fprintf(b, "  processed %d, skipped %d, failed %d\n", r.Processed, total(r.Skipped), total(r.Failed))
+	counts := func(title string, m map[string]int) {
+		for _, reason := range sortedKeys(m) {
+			fmt.Fprintf(b, "    %s %s: %d\n", title, reason, m[reason])
+		}
+	}
+	counts("skipped", r.Skipped)
+	counts("failed", r.Failed)
+	for _, p := range r.Phases {
+		fmt.Fprintf(b, "  %s took %s\n", p.Name, time.Duration(p.Seconds*float64(time.Second)).Round(time.Millisecond))
+	}
+	list := func(title string, n int, line func(i int) string) {
+		if n == 0 {
+			return
+		}
+		fmt.Fprintf(b, "%s (%d):\n", title, n)
+		for i := 0; i < n; i++ {
+			if limit > 0 && i == limit {
+				fmt.Fprintf(b, "  ... and %d more\n", n-limit)
+				break
+			}
+			fmt.Fprintf(b, "  %s\n", line(i))
+		}
+	}
+	list("failures", len(r.Failures), func(i int) string {
+		f := r.Failures[i]
+		return fmt.Sprintf("%s: %s: %s", f.Path, f.Reason, f.Error)
+	})
+	list("mismatches", len(r.Mismatches), func(i int) string {
+		m := r.Mismatches[i]
+		return fmt.Sprintf("%s: %s filename=%s acoustic=%s confidence=%.2f", m.Path, m.Attribute, m.Filename, m.Acoustic, m.Confidence)
+	})
+	list("fallback keys", len(r.FallbackKeys), func(i int) string {
+		return r.FallbackKeys[i].Path + ": " + r.FallbackKeys[i].Key
+	})
+	list("unclassified", len(r.Unclassified), func(i int) string { return r.Unclassified[i] })
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func total(m map[string]int) int {
+	n := 0
+	for _, v := range m {
+		n += v
+	}
+	return n
+}
+
+func sortedKeys(m map[string]int) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
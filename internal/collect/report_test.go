@@ -0,0 +1,76 @@
+package collect
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"gopkg.in/music-theory.v0/key"
+)
+
+func TestReport(t *testing.T) {
+	var none *Report
+	none.Skip("filtered")
+	none.Phase("scan")()
+
+	r := NewReport("scan")
+	r.AddProcessed()
+	r.AddProcessed()
+	r.Skip("duplicate")
+	r.Fail("/src/broken.wav", "analysis", errors.New("bad header"))
+	r.Mismatch(Mismatch{Path: "/src/loop_120bpm.wav", Attribute: "tempo", Filename: "120", Acoustic: "90", Confidence: 0.4})
+	r.FallbackKey("/src/pad_A.wav", "A")
+	r.Phase("scan src")()
+
+	c := NewCollection()
+	c.IngestSample(&Sample{Name: "pad.wav", Path: "/src/pad.wav", Key: key.Of("C"), Types: map[SampleType]struct{}{}})
+	c.IngestSample(&Sample{Name: "noise.wav", Path: "/src/noise.wav", Root: "src", Types: map[SampleType]struct{}{}})
+	r.Finish(c)
+	if len(r.Unclassified) != 1 || r.Unclassified[0] != "/src/noise.wav" {
+		t.Errorf("unclassified %v, want only noise.wav", r.Unclassified)
+	}
+
+	path := filepath.Join(t.TempDir(), "report.json")
+	if err := r.Save(path); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := LoadReport(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := new(strings.Builder)
+	if err = loaded.WriteSummary(b, 0); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"processed 2, skipped 1, failed 1", "skipped duplicate: 1", "scan src took",
+		"/src/broken.wav: analysis: bad header", "tempo filename=120 acoustic=90 confidence=0.40",
+		"/src/pad_A.wav: A", "unclassified (1)",
+	} {
+		if !strings.Contains(b.String(), want) {
+			t.Errorf("summary lacks %q:\n%s", want, b)
+		}
+	}
+}
+
+func TestReportMIDIKeyMismatch(t *testing.T) {
+	defer func(r *Report) { Run = r }(Run)
+	Run = NewReport("scan")
+
+	var notes []midiNote
+	for bar := uint64(0); bar < 4; bar++ {
+		for _, pitch := range []uint8{45, 57, 60, 64} {
+			notes = append(notes, midiNote{Pitch: pitch, Velocity: 100, Start: bar * 384, Duration: 384})
+		}
+	}
+	s := &Sample{Name: "chords_C.mid", Path: "/src/chords_C.mid", Key: key.Of("C major")}
+	s.applyMIDI(&midiFile{Division: 96, Notes: notes, Length: 4 * 384})
+	if len(Run.Mismatches) != 1 {
+		t.Fatalf("mismatches %+v, want one", Run.Mismatches)
+	}
+	m := Run.Mismatches[0]
+	if m.Path != s.Path || m.Attribute != "key" || m.Filename != keyName(key.Of("C major")) || m.Acoustic != keyName(s.Key) || m.Confidence <= 0 {
+		t.Errorf("mismatch %+v, key now %v", m, s.Key)
+	}
+}
@@ -0,0 +1,86 @@
+package collect
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	"git.tcp.direct/kayos/keepr/internal/config"
+	"git.tcp.direct/kayos/keepr/internal/util"
+)
+
+// Without returns a new Collection holding every sample of c for which drop returns false.
+func (c *Collection) Without(drop func(*Sample) bool) *Collection {
+	next := NewCollection()
+	for _, s := range c.Filter(func(s *Sample) bool { return !drop(s) }) {
+		next.IngestSample(s)
+	}
+	return next
+}
+
+// Under reports whether path is dir or inside it.
+func Under(path, dir string) bool {
+	return path == dir || strings.HasPrefix(path, strings.TrimSuffix(dir, string(filepath.Separator))+string(filepath.Separator))
+}
+
+// SyncLinks updates a link tree built from old so that it matches next, touching only the links
+// of samples that joined or left a view. Links are added in the background, callers wait on Backlog.
+func SyncLinks(old, next *Collection) (added, removed int) {
+	before, after := old.Views(), next.Views()
+	for view, samples := range before {
+		stay := make(map[*Sample]struct{}, len(after[view]))
+		for _, s := range after[view] {
+			stay[s] = struct{}{}
+		}
+		dir := util.APath(filepath.Join(config.Output, filepath.FromSlash(view)))
+		for _, s := range samples {
+			if _, ok := stay[s]; ok {
+				continue
+			}
+			if unlink(filepath.Join(dir, s.Name)) {
+				removed++
+			}
+		}
+		if !config.Simulate {
+			// only succeeds once the view is empty
+			_ = os.Remove(dir)
+		}
+	}
+	for view, samples := range after {
+		had := make(map[*Sample]struct{}, len(before[view]))
+		for _, s := range before[view] {
+			had[s] = struct{}{}
+		}
+		dir := util.APath(filepath.Join(config.Output, filepath.FromSlash(view)))
+		for _, s := range samples {
+			if _, ok := had[s]; ok {
+				continue
+			}
+			if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+				log.Warn().Str("path", dir).Err(err).Msg("failed to create view")
+				break
+			}
+			spawnLink(s, dir)
+			added++
+		}
+	}
+	return added, removed
+}
+
+// unlink removes the view entry at path: a symlink, or a hardlink or copy with --link-mode.
+// Directories are left alone.
+func unlink(path string) bool {
+	fi, err := os.Lstat(path)
+	if err != nil || (fi.Mode()&os.ModeSymlink == 0 && !fi.Mode().IsRegular()) {
+		return false
+	}
+	if config.Simulate {
+		log.Printf("would have removed %s", path)
+		return true
+	}
+	if err = os.Remove(path); err != nil {
+		log.Warn().Str("path", path).Err(err).Msg("failed to remove link")
+		return false
+	}
+	return true
+}
@@ -0,0 +1,63 @@
+package collect
+
+import (
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"gopkg.in/music-theory.v0/key"
+
+	"git.tcp.direct/kayos/keepr/internal/config"
+)
+
+func TestSyncLinks(t *testing.T) {
+	src, out := t.TempDir(), t.TempDir()
+	defer func(o string) { config.Output = o }(config.Output)
+	config.Output = out
+
+	sample := func(name string, k string) *Sample {
+		path := filepath.Join(src, name)
+		if err := os.WriteFile(path, nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return &Sample{Name: name, Path: path, Key: key.Of(k), Types: map[SampleType]struct{}{}}
+	}
+	wait := func() {
+		for atomic.LoadInt32(&Backlog) != 0 {
+			time.Sleep(time.Millisecond)
+		}
+	}
+	exists := func(path string) bool {
+		_, err := os.Lstat(filepath.Join(out, path))
+		return err == nil
+	}
+
+	stays, goes := sample("stays.wav", "Am"), sample("goes.wav", "Am")
+	old := NewCollection()
+	old.IngestSample(stays)
+	old.IngestSample(goes)
+	added, removed := SyncLinks(NewCollection(), old)
+	wait()
+	if added != 2 || removed != 0 || !exists("Key/A_Minor/stays.wav") || !exists("Key/A_Minor/goes.wav") {
+		t.Fatalf("initial sync added %d removed %d", added, removed)
+	}
+
+	next := old.Without(func(s *Sample) bool { return s == goes })
+	next.IngestSample(sample("new.wav", "C"))
+	added, removed = SyncLinks(old, next)
+	wait()
+	if added != 1 || removed != 1 {
+		t.Errorf("added %d removed %d, want 1 and 1", added, removed)
+	}
+	if !exists("Key/A_Minor/stays.wav") || exists("Key/A_Minor/goes.wav") || !exists("Key/C_Major/new.wav") {
+		t.Error("links don't match the collection")
+	}
+
+	added, removed = SyncLinks(next, next.Without(func(*Sample) bool { return true }))
+	wait()
+	if added != 0 || removed != 2 || exists("Key/A_Minor") || exists("Key/C_Major") {
+		t.Errorf("emptying added %d removed %d, views left behind: %v %v", added, removed, exists("Key/A_Minor"), exists("Key/C_Major"))
+	}
+}
@@ -0,0 +1,221 @@
+package collect
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/go-audio/wav"
+
+	"git.tcp.direct/kayos/keepr/internal/analysis"
+	"git.tcp.direct/kayos/keepr/internal/config"
+)
+
+// Thumbnail kinds, each cached as <sample ID>.<kind> in the thumbnail directory.
+const (
+	ThumbPeaks       = "peaks.json"
+	ThumbWaveform    = "waveform.png"
+	ThumbSpectrogram = "spectrogram.png"
+)
+
+// ThumbnailKinds are every kind of thumbnail a sample gets.
+var ThumbnailKinds = []string{ThumbPeaks, ThumbWaveform, ThumbSpectrogram}
+
+// ErrNoAudio is returned for samples we can't draw, such as MIDI files.
+var ErrNoAudio = errors.New("no audio to draw")
+
+const (
+	// peaksLength is how many min/max pairs the peaks JSON holds.
+	peaksLength = 800
+	// peaksBits is the resolution of the peaks JSON, values run from -128 to 127.
+	peaksBits         = 8
+	thumbWidth        = 400
+	waveformHeight    = 64
+	spectrogramHeight = 128
+)
+
+// Peaks is a sample's waveform in the JSON format of audiowaveform, which peaks.js and friends read:
+// Data holds Length min/max pairs, each covering SamplesPerPixel samples, scaled to Bits.
+type Peaks struct {
+	Version         int   `json:"version"`
+	Channels        int   `json:"channels"`
+	SampleRate      int   `json:"sample_rate"`
+	SamplesPerPixel int   `json:"samples_per_pixel"`
+	Bits            int   `json:"bits"`
+	Length          int   `json:"length"`
+	Data            []int `json:"data"`
+}
+
+// ThumbnailPath is where the thumbnail of kind is cached for s.
+func ThumbnailPath(s *Sample, kind string) string {
+	return config.StatePath("thumbs", s.ID()+"."+kind)
+}
+
+// HasAudio reports whether s is an audio file we can draw.
+func (s *Sample) HasAudio() bool {
+	return strings.EqualFold(filepath.Ext(s.Path), ".wav")
+}
+
+// ThumbnailsFresh reports whether every thumbnail of s is cached and newer than the sample.
+func (s *Sample) ThumbnailsFresh() bool {
+	for _, kind := range ThumbnailKinds {
+		fi, err := os.Stat(ThumbnailPath(s, kind))
+		if err != nil || fi.ModTime().Before(s.ModTime) {
+			return false
+		}
+	}
+	return true
+}
+
+// Thumbnails renders the thumbnails of s into the cache unless they are fresh already.
+// It reports whether it rendered anything.
+func (s *Sample) Thumbnails() (bool, error) {
+	if !s.HasAudio() {
+		return false, ErrNoAudio
+	}
+	if s.ThumbnailsFresh() {
+		return false, nil
+	}
+	mono, rate, err := decodeMono(s.Path)
+	if err != nil {
+		return false, err
+	}
+	return true, s.renderThumbnails(mono, rate)
+}
+
+// LoadPeaks returns the peaks of s, rendering its thumbnails first if needed.
+func (s *Sample) LoadPeaks() (*Peaks, error) {
+	if _, err := s.Thumbnails(); err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(ThumbnailPath(s, ThumbPeaks))
+	if err != nil {
+		return nil, err
+	}
+	peaks := new(Peaks)
+	return peaks, json.Unmarshal(data, peaks)
+}
+
+// decodeMono reads the WAV file at path as mono PCM.
+func decodeMono(path string) ([]float32, int, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer f.Close()
+	buf, err := wav.NewDecoder(f).FullPCMBuffer()
+	if err != nil {
+		return nil, 0, fmt.Errorf("couldn't decode %s: %w", path, err)
+	}
+	return toMonoFloat32(buf), int(buf.Format.SampleRate), nil
+}
+
+// renderThumbnails draws every kind of thumbnail of s from its mono PCM and writes them to the cache.
+func (s *Sample) renderThumbnails(mono []float32, rate int) error {
+	if len(mono) == 0 || rate == 0 {
+		return ErrNoAudio
+	}
+	peaks := &Peaks{Version: 2, Channels: 1, SampleRate: rate, Bits: peaksBits}
+	pairs := analysis.Peaks(mono, peaksLength)
+	peaks.Length = len(pairs) / 2
+	peaks.SamplesPerPixel = int(math.Ceil(float64(len(mono)) / float64(peaks.Length)))
+	peaks.Data = make([]int, len(pairs))
+	for i, v := range pairs {
+		peaks.Data[i] = int(math.Max(-128, math.Min(127, math.Round(float64(v)*128))))
+	}
+	peaksJSON, err := json.Marshal(peaks)
+	if err != nil {
+		return err
+	}
+
+	waveform, err := encodePNG(drawWaveform(analysis.Peaks(mono, thumbWidth)))
+	if err != nil {
+		return err
+	}
+	spectrogram, err := encodePNG(drawSpectrogram(analysis.Spectrogram(mono, rate, thumbWidth, spectrogramHeight)))
+	if err != nil {
+		return err
+	}
+
+	dir := config.StatePath("thumbs")
+	if err = os.MkdirAll(dir, os.ModePerm); err != nil {
+		return err
+	}
+	for kind, data := range map[string][]byte{ThumbPeaks: peaksJSON, ThumbWaveform: waveform, ThumbSpectrogram: spectrogram} {
+		// written aside and renamed so that nobody reads half a thumbnail
+		path := ThumbnailPath(s, kind)
+		tmp, err := os.CreateTemp(dir, ".tmp-*")
+		if err != nil {
+			return err
+		}
+		_, err = tmp.Write(data)
+		if cerr := tmp.Close(); err == nil {
+			err = cerr
+		}
+		if err == nil {
+			err = os.Rename(tmp.Name(), path)
+		}
+		if err != nil {
+			_ = os.Remove(tmp.Name())
+			return err
+		}
+	}
+	log.Debug().Str("path", s.Path).Msg("rendered thumbnails")
+	return nil
+}
+
+var waveformColor = color.RGBA{R: 0x55, G: 0x88, B: 0xaa, A: 0xff}
+
+// drawWaveform draws interleaved min/max peaks, one pair per column, on a transparent background.
+func drawWaveform(peaks []float32) image.Image {
+	img := image.NewRGBA(image.Rect(0, 0, thumbWidth, waveformHeight))
+	columns := len(peaks) / 2
+	half := float64(waveformHeight) / 2
+	for x := 0; x < columns; x++ {
+		top := int(math.Round(half - float64(peaks[2*x+1])*half))
+		bottom := int(math.Round(half - float64(peaks[2*x])*half))
+		for y := max(top, 0); y <= min(bottom, waveformHeight-1); y++ {
+			img.SetRGBA(x, y, waveformColor)
+		}
+	}
+	return img
+}
+
+// heat are the colors spectrogram levels run through, from silent to loudest.
+var heat = []color.RGBA{
+	{R: 0x00, G: 0x00, B: 0x04, A: 0xff},
+	{R: 0x51, G: 0x12, B: 0x7c, A: 0xff},
+	{R: 0xb7, G: 0x37, B: 0x79, A: 0xff},
+	{R: 0xfc, G: 0x89, B: 0x61, A: 0xff},
+	{R: 0xfc, G: 0xfd, B: 0xbf, A: 0xff},
+}
+
+// drawSpectrogram draws spectrogram columns left to right, low frequencies at the bottom.
+func drawSpectrogram(spec [][]float64) image.Image {
+	img := image.NewRGBA(image.Rect(0, 0, len(spec), spectrogramHeight))
+	for x, column := range spec {
+		for band, level := range column {
+			pos := level * float64(len(heat)-1)
+			i := min(int(pos), len(heat)-2)
+			frac := pos - float64(i)
+			lo, hi := heat[i], heat[i+1]
+			mix := func(a, b uint8) uint8 { return uint8(float64(a) + (float64(b)-float64(a))*frac) }
+			img.SetRGBA(x, spectrogramHeight-1-band, color.RGBA{R: mix(lo.R, hi.R), G: mix(lo.G, hi.G), B: mix(lo.B, hi.B), A: 0xff})
+		}
+	}
+	return img
+}
+
+func encodePNG(img image.Image) ([]byte, error) {
+	var buf bytes.Buffer
+	err := png.Encode(&buf, img)
+	return buf.Bytes(), err
+}
@@ -0,0 +1,65 @@
+package collect
+
+import (
+	"image/png"
+	"math"
+	"os"
+	"testing"
+	"time"
+
+	"git.tcp.direct/kayos/keepr/internal/config"
+)
+
+func TestRenderThumbnails(t *testing.T) {
+	defer func(output string) { config.Output = output }(config.Output)
+	config.Output = t.TempDir()
+
+	const rate = 44100
+	mono := make([]float32, rate)
+	for i := range mono {
+		// a 440 Hz tone fading in
+		mono[i] = float32(float64(i) / rate * math.Sin(2*math.Pi*440*float64(i)/rate))
+	}
+	s := &Sample{Name: "tone.wav", Path: "/src/tone.wav", ModTime: time.Now().Add(-time.Minute)}
+	if s.ThumbnailsFresh() {
+		t.Fatal("fresh before rendering")
+	}
+	if err := s.renderThumbnails(mono, rate); err != nil {
+		t.Fatal(err)
+	}
+	if !s.ThumbnailsFresh() {
+		t.Error("stale right after rendering")
+	}
+
+	peaks, err := s.LoadPeaks()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if peaks.Length != peaksLength || len(peaks.Data) != 2*peaksLength || peaks.SampleRate != rate {
+		t.Errorf("peaks: length %d, %d values, rate %d", peaks.Length, len(peaks.Data), peaks.SampleRate)
+	}
+	// quiet at the start, close to full scale at the end
+	n := len(peaks.Data)
+	if first, last := peaks.Data[1]-peaks.Data[0], peaks.Data[n-1]-peaks.Data[n-2]; first > 2 || last < 120 {
+		t.Errorf("first bucket spans %d, last %d", first, last)
+	}
+
+	for kind, height := range map[string]int{ThumbWaveform: waveformHeight, ThumbSpectrogram: spectrogramHeight} {
+		f, err := os.Open(ThumbnailPath(s, kind))
+		if err != nil {
+			t.Fatal(err)
+		}
+		img, err := png.Decode(f)
+		f.Close()
+		if err != nil {
+			t.Fatalf("%s: %v", kind, err)
+		}
+		if b := img.Bounds(); b.Dx() != thumbWidth || b.Dy() != height {
+			t.Errorf("%s is %dx%d", kind, b.Dx(), b.Dy())
+		}
+	}
+
+	if _, err = (&Sample{Path: "/src/chords.mid"}).Thumbnails(); err != ErrNoAudio {
+		t.Errorf("MIDI thumbnails: %v, want ErrNoAudio", err)
+	}
+}
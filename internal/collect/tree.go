@@ -0,0 +1,110 @@
+package collect
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"git.tcp.direct/kayos/keepr/internal/config"
+)
+
+// walkLinks calls fn for every symlink found in the output tree rooted at root,
+// skipping our own state directory.
+func walkLinks(root string, fn func(path string) error) error {
+	return filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() && d.Name() == config.StateDir {
+			return filepath.SkipDir
+		}
+		if d.Type()&fs.ModeSymlink == 0 {
+			return nil
+		}
+		return fn(path)
+	})
+}
+
+// Dangling returns every symlink under root whose target no longer exists.
+func Dangling(root string) ([]string, error) {
+	var dangling []string
+	err := walkLinks(root, func(path string) error {
+		if _, err := os.Stat(path); err != nil {
+			dangling = append(dangling, path)
+		}
+		return nil
+	})
+	return dangling, err
+}
+
+// Prune removes dangling symlinks and then any directories left empty under root.
+// It returns the paths that were (or, when simulating, would have been) removed.
+func Prune(root string) ([]string, error) {
+	dangling, err := Dangling(root)
+	if err != nil {
+		return nil, err
+	}
+	removed := make(map[string]struct{})
+	for _, path := range dangling {
+		if config.Simulate {
+			log.Printf("would have removed %s", path)
+		} else if err = os.Remove(path); err != nil {
+			log.Warn().Str("path", path).Err(err).Msg("failed to remove dangling link")
+			continue
+		}
+		removed[path] = struct{}{}
+	}
+
+	var dirs []string
+	err = filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() {
+			return nil
+		}
+		if d.Name() == config.StateDir {
+			return filepath.SkipDir
+		}
+		if path != root {
+			dirs = append(dirs, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	// deepest first, so parents emptied by their children are caught too
+	sort.Slice(dirs, func(i, j int) bool { return len(dirs[i]) > len(dirs[j]) })
+	for _, dir := range dirs {
+		entries, rerr := os.ReadDir(dir)
+		if rerr != nil {
+			continue
+		}
+		empty := true
+		for _, e := range entries {
+			if _, gone := removed[filepath.Join(dir, e.Name())]; !gone {
+				empty = false
+				break
+			}
+		}
+		if !empty {
+			continue
+		}
+		if config.Simulate {
+			log.Printf("would have removed %s", dir)
+		} else if err = os.Remove(dir); err != nil {
+			log.Warn().Str("path", dir).Err(err).Msg("failed to remove empty directory")
+			continue
+		}
+		removed[dir] = struct{}{}
+	}
+
+	res := make([]string, 0, len(removed))
+	for path := range removed {
+		res = append(res, path)
+	}
+	sort.Strings(res)
+	return res, nil
+}
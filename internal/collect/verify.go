@@ -0,0 +1,164 @@
+package collect
+
+import (
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+
+	"git.tcp.direct/kayos/keepr/internal/config"
+	"git.tcp.direct/kayos/keepr/internal/util"
+)
+
+// Kinds of Problem.
+const (
+	// ProblemDangling is a symlink whose target is gone.
+	ProblemDangling = "dangling"
+	// ProblemMisclassified is a view entry the catalog doesn't put in that view (any more).
+	ProblemMisclassified = "misclassified"
+	// ProblemStray is a file in the output tree that keepr didn't put there.
+	ProblemStray = "stray"
+)
+
+// Problem is something wrong with an entry of the output tree.
+type Problem struct {
+	Path   string
+	Kind   string
+	Detail string
+}
+
+// outputExtras are the entries at the top of the output tree that aren't views.
+var outputExtras = map[string]struct{}{config.StateDir: {}, "Playlists": {}, "keepr.yml": {}}
+
+// Verify walks the output tree at root and reports the entries that don't match c, sorted by path.
+func (c *Collection) Verify(root string) ([]Problem, error) {
+	// where every sample is expected, by view entry path relative to root
+	expected := make(map[string][]*Sample)
+	for view, samples := range c.Views() {
+		for _, s := range samples {
+			p := path.Join(view, s.Name)
+			expected[p] = append(expected[p], s)
+		}
+	}
+	byPath := make(map[string]*Sample, len(c.Samples))
+	bySize := make(map[int64][]*Sample)
+	for _, s := range c.Samples {
+		byPath[s.Path] = s
+		bySize[s.Size] = append(bySize[s.Size], s)
+	}
+
+	var problems []Problem
+	report := func(p, kind, detail string) {
+		problems = append(problems, Problem{Path: p, Kind: kind, Detail: detail})
+	}
+	err := filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(root, p)
+		if err != nil || rel == "." {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if _, extra := outputExtras[rel]; extra {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() {
+			return nil
+		}
+		want := expected[rel]
+
+		if d.Type()&fs.ModeSymlink != 0 {
+			target, err := os.Readlink(p)
+			if err != nil {
+				return err
+			}
+			if !filepath.IsAbs(target) {
+				target = filepath.Join(filepath.Dir(p), target)
+			}
+			target = filepath.Clean(target)
+			if _, err = os.Stat(p); err != nil {
+				report(p, ProblemDangling, "target "+target+" is gone")
+				return nil
+			}
+			for _, s := range want {
+				if s.Path == target {
+					return nil
+				}
+			}
+			if s, ok := byPath[target]; !ok {
+				report(p, ProblemMisclassified, "target "+target+" isn't cataloged")
+			} else {
+				report(p, ProblemMisclassified, s.Path+" doesn't belong in "+path.Dir(rel))
+			}
+			return nil
+		}
+
+		fi, err := d.Info()
+		if err != nil {
+			return err
+		}
+		// a hardlink, or a reflink or copy made with --link-mode, which only their size and fingerprint
+		// tell apart from any other file
+		var fingerprint string
+		copyOf := func(s *Sample) (bool, error) {
+			if s.Size != fi.Size() {
+				return false, nil
+			}
+			if orig, err := os.Stat(s.Path); err == nil && os.SameFile(fi, orig) {
+				return true, nil
+			}
+			if fingerprint == "" {
+				if fingerprint, err = util.Fingerprint(p); err != nil {
+					return false, err
+				}
+			}
+			theirs := s.Fingerprint
+			if theirs == "" {
+				// cataloged before fingerprints were
+				if theirs, err = util.Fingerprint(s.Path); err != nil {
+					return false, nil
+				}
+			}
+			return fingerprint == theirs, nil
+		}
+		gone := func(s *Sample) bool {
+			_, err := os.Stat(s.Path)
+			return err != nil
+		}
+		for _, s := range want {
+			ok, err := copyOf(s)
+			if err != nil {
+				return err
+			} else if !ok {
+				continue
+			}
+			if gone(s) {
+				report(p, ProblemDangling, "original "+s.Path+" is gone")
+			}
+			return nil
+		}
+		for _, s := range bySize[fi.Size()] {
+			ok, err := copyOf(s)
+			if err != nil {
+				return err
+			} else if !ok {
+				continue
+			}
+			if gone(s) {
+				report(p, ProblemDangling, "original "+s.Path+" is gone")
+			} else {
+				report(p, ProblemMisclassified, s.Path+" doesn't belong in "+path.Dir(rel))
+			}
+			return nil
+		}
+		report(p, ProblemStray, "not a link keepr made")
+		return nil
+	})
+	sort.Slice(problems, func(i, j int) bool { return problems[i].Path < problems[j].Path })
+	return problems, err
+}
@@ -0,0 +1,128 @@
+package collect
+
+import (
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"gopkg.in/music-theory.v0/key"
+
+	"git.tcp.direct/kayos/keepr/internal/config"
+	"git.tcp.direct/kayos/keepr/internal/util"
+)
+
+func TestVerifyAndRelocate(t *testing.T) {
+	src, moved, out := t.TempDir(), t.TempDir(), t.TempDir()
+	defer func(o string) { config.Output = o }(config.Output)
+	config.Output = out
+
+	sample := func(name, k, data string) *Sample {
+		path := filepath.Join(src, name)
+		if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		s := &Sample{Name: name, Path: path, Root: "src", Key: key.Of(k), Types: map[SampleType]struct{}{}, Size: int64(len(data))}
+		var err error
+		if s.Fingerprint, err = util.Fingerprint(path); err != nil {
+			t.Fatal(err)
+		}
+		return s
+	}
+	wait := func() {
+		for atomic.LoadInt32(&Backlog) != 0 {
+			time.Sleep(time.Millisecond)
+		}
+	}
+
+	kick, pad := sample("kick.wav", "Am", "kick"), sample("pad.wav", "C", "pad")
+	lib := NewCollection()
+	lib.IngestSample(kick)
+	lib.IngestSample(pad)
+	SyncLinks(NewCollection(), lib)
+	wait()
+	// as --link-mode copy would have it
+	copyTo := func(p, data string) {
+		if err := os.MkdirAll(filepath.Dir(p), os.ModePerm); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Remove(p); err != nil && !os.IsNotExist(err) {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	copied, copiedKick := filepath.Join(out, "Key", "C_Major", "pad.wav"), filepath.Join(out, "Sources", "src", "kick.wav")
+	copyTo(copied, "pad")
+	copyTo(copiedKick, "kick")
+	if problems, err := lib.Verify(out); err != nil || len(problems) != 0 {
+		t.Fatalf("fresh library: %v %v", problems, err)
+	}
+	// the same size isn't the same file
+	copyTo(copied, "dap")
+	copyTo(filepath.Join(out, "Tempo", "120", "pad.wav"), "pad")
+
+	if err := os.WriteFile(filepath.Join(out, "Key", "A_Minor", "notes.txt"), nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(pad.Path, filepath.Join(out, "Key", "A_Minor", "pad.wav")); err != nil {
+		t.Fatal(err)
+	}
+	// renamed as well as moved, only the fingerprint can find it
+	if err := os.Rename(kick.Path, filepath.Join(moved, "kick_01.wav")); err != nil {
+		t.Fatal(err)
+	}
+	problems, err := lib.Verify(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Problem{
+		{Path: filepath.Join(out, "Key", "A_Minor", "kick.wav"), Kind: ProblemDangling},
+		{Path: filepath.Join(out, "Key", "A_Minor", "notes.txt"), Kind: ProblemStray},
+		{Path: filepath.Join(out, "Key", "A_Minor", "pad.wav"), Kind: ProblemMisclassified},
+		{Path: copied, Kind: ProblemStray},
+		{Path: copiedKick, Kind: ProblemDangling},
+		{Path: filepath.Join(out, "Tempo", "120", "pad.wav"), Kind: ProblemMisclassified},
+	}
+	if len(problems) != len(want) {
+		t.Fatalf("got %v, want %v", problems, want)
+	}
+	for i := range want {
+		if problems[i].Path != want[i].Path || problems[i].Kind != want[i].Kind {
+			t.Errorf("problem %d is %v, want %v", i, problems[i], want[i])
+		}
+	}
+
+	missing := lib.Missing()
+	if len(missing) != 1 || missing[0] != kick {
+		t.Fatalf("missing %v", missing)
+	}
+	// a generation of the library swapped out by an atomic link isn't where kick went, even by name
+	prev := PreviousPath(out)
+	if err := os.MkdirAll(prev, os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(prev, "kick.wav"), []byte("kick"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	roots := []*config.SourceRoot{{Path: moved, Label: "moved"}, {Path: filepath.Dir(out), Label: "all"}}
+	found := lib.Relocate(missing, roots, func(*config.SourceRoot, string, bool) bool { return false })
+	if found[kick] != filepath.Join(src, "kick.wav") || kick.Path != filepath.Join(moved, "kick_01.wav") || kick.Root != "moved" || kick.Name != "kick.wav" {
+		t.Fatalf("relocated %v to %s in %s", found, kick.Path, kick.Root)
+	}
+	next := lib.Without(func(*Sample) bool { return false })
+	if n := next.Relink(lib, found); n != 2 {
+		t.Errorf("relinked %d entries, want 2", n)
+	}
+	wait()
+	for _, p := range []string{"Key/A_Minor/kick.wav", "Sources/moved/kick.wav"} {
+		if target, err := os.Readlink(filepath.Join(out, filepath.FromSlash(p))); err != nil || target != kick.Path {
+			t.Errorf("%s links to %q, %v", p, target, err)
+		}
+	}
+	if _, err := os.Lstat(filepath.Join(out, "Sources", "src", "kick.wav")); err == nil {
+		t.Error("old source root view still has kick.wav")
+	}
+}
@@ -0,0 +1,106 @@
+package collect
+
+import (
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Views maps the directory of every view the Symlink functions create, relative to the
+// output directory and with forward slashes, to the samples linked into it.
+func (c *Collection) Views() map[string][]*Sample {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	views := make(map[string][]*Sample)
+	add := func(dir string, s *Sample) {
+		views[dir] = append(views[dir], s)
+	}
+	for t, ss := range c.Tempos {
+		for _, s := range ss {
+			add(path.Join("Tempo", strconv.Itoa(t)), s)
+		}
+	}
+	for k, ss := range c.Keys {
+		dir := path.Join("Key", k.Root.String(k.AdjSymbol)+modeStr(k))
+		for _, s := range ss {
+			if s.IsType(TypeOneShot) {
+				add(path.Join(dir, "OneShots"), s)
+				continue
+			}
+			add(dir, s)
+		}
+	}
+	for t, ss := range c.Drums {
+		for _, s := range ss {
+			add(path.Join("Drums", drumToDirMap[t]), s)
+		}
+	}
+	for _, s := range c.MelodicLoops {
+		if s.IsType(TypeOneShot) || s.IsType(TypeDrum) || s.IsType(TypeDrumLoop) {
+			continue
+		}
+		add("Melodic Loops", s)
+	}
+	for _, s := range c.MIDIs {
+		for _, dir := range midiViews(s) {
+			add(path.Join("MIDI", dir), s)
+		}
+	}
+	named := []struct {
+		dir     string
+		samples map[string][]*Sample
+	}{
+		{"Artists", c.Artists}, {"Genres", c.Genres}, {"Source Tags", c.Sources},
+		{"Sources", c.Roots}, {"Creation Dates", c.CreationDates}, {"Software", c.Software},
+	}
+	for _, n := range named {
+		for name, ss := range n.samples {
+			for _, s := range ss {
+				add(path.Join(n.dir, name), s)
+			}
+		}
+	}
+	return views
+}
+
+// midiViews lists the directories under MIDI/ that SymlinkMIDIs links s into.
+func midiViews(s *Sample) []string {
+	var dirs []string
+	if s.Key.Root != 0 {
+		dirs = append(dirs, path.Join("Key", s.Key.Root.String(s.Key.AdjSymbol)+modeStr(s.Key)))
+	}
+	if s.Tempo > 0 {
+		dirs = append(dirs, path.Join("Tempo", strconv.Itoa(s.Tempo)))
+	}
+	if s.MIDI != nil && s.MIDI.Kind != MIDIUnknown {
+		dirs = append(dirs, midiKindToDirMap[s.MIDI.Kind])
+	}
+	if s.Progression != nil && len(s.Progression.Numerals) > 0 {
+		dirs = append(dirs, path.Join("Progressions", s.Progression.Dir()))
+	}
+	if s.MIDI != nil {
+		dirs = append(dirs, path.Join("TimeSig", strings.ReplaceAll(s.MIDI.TimeSignature, "/", "-")))
+		if bars := s.MIDI.WholeBars(); bars > 0 {
+			dirs = append(dirs, path.Join("Bars", strconv.Itoa(bars)))
+		}
+		for _, family := range s.MIDI.Instruments {
+			dirs = append(dirs, path.Join("Instrument", family))
+		}
+	}
+	return append(dirs, "All")
+}
+
+// Categories inverts Views: every sample's view directories, sorted.
+func (c *Collection) Categories() map[*Sample][]string {
+	cats := make(map[*Sample][]string)
+	for dir, ss := range c.Views() {
+		for _, s := range ss {
+			cats[s] = append(cats[s], dir)
+		}
+	}
+	for _, dirs := range cats {
+		sort.Strings(dirs)
+	}
+	return cats
+}
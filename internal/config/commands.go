@@ -0,0 +1,248 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// command describes a keepr subcommand and the flags it accepts.
+type command struct {
+	name    string
+	args    string
+	summary string
+	flags   []string
+}
+
+// commands are listed in the order they are shown in help output.
+var commands = []*command{
+	{
+		name:    "scan",
+		summary: "walk the source directory, analyze every sample and save the catalog",
+		flags: []string{
+			"--source", "--include", "--exclude", "--no-default-ignores", "--follow-symlinks",
+			"--no-midi", "--fast", "--analyze-seconds", "--thumbnails",
+		},
+	},
+	{
+		name:    "link",
+		summary: "(re)build the symlink library from the saved catalog",
+		flags:   []string{"--relative", "--link-mode", "--atomic", "--no-op", "--playlist", "--playlists-only"},
+	},
+	{
+		name:    "watch",
+		summary: "keep the catalog and the link library in sync with the source directories as they change",
+		flags: []string{
+			"--source", "--include", "--exclude", "--no-default-ignores",
+			"--no-midi", "--fast", "--analyze-seconds", "--thumbnails",
+			"--relative", "--link-mode", "--no-op", "--playlist", "--debounce",
+		},
+	},
+	{
+		name:    "stats",
+		summary: "print statistics about the saved catalog",
+	},
+	{
+		name:    "query",
+		args:    "[EXPRESSION...]",
+		summary: "print the cataloged samples matching EXPRESSION, or link them into a folder",
+		flags: []string{
+			"--key", "--tempo", "--type", "--timesig", "--bars", "--instrument", "--range", "--sort",
+			"--format", "--link", "--link-mode",
+		},
+	},
+	{
+		name:    "export",
+		summary: "write the saved catalog out for use by other tools",
+		flags:   []string{"--format", "--file", "--range", "--sort", "--peaks"},
+	},
+	{
+		name:    "mount",
+		args:    "DIR",
+		summary: "mount the views of the saved catalog and any saved queries read-only at DIR, without symlinks",
+		flags:   []string{"--query"},
+	},
+	{
+		name:    "thumbs",
+		summary: "render waveform and spectrogram thumbnails of every cataloged sample that lacks fresh ones",
+	},
+	{
+		name:    "serve",
+		summary: "browse, search and preview the saved catalog in a web browser",
+		flags:   []string{"--listen"},
+	},
+	{
+		name:    "report",
+		summary: "print the report of the last scan: failures, filename and audio mismatches, fallback keys and unclassified files",
+	},
+	{
+		name:    "rollback",
+		summary: "swap the library an --atomic link replaced back in, again to undo",
+	},
+	{
+		name:    "prune",
+		summary: "remove dangling links and empty directories from the output directory",
+		flags:   []string{"--no-op"},
+	},
+	{
+		name:    "verify",
+		summary: "report dangling, misclassified and stray entries in the output directory",
+	},
+	{
+		name:    "repair",
+		summary: "find moved source files under new source directories by size and fingerprint, and relink them",
+		flags: []string{
+			"--source", "--include", "--exclude", "--no-default-ignores",
+			"--relative", "--link-mode", "--no-op",
+		},
+	},
+}
+
+// legacy is what runs when keepr is invoked without a subcommand: scan, then link (or print stats).
+var legacy = &command{
+	name:    "",
+	summary: "scan and link in one go",
+	flags: []string{
+		"--source", "--include", "--exclude", "--no-default-ignores", "--follow-symlinks",
+		"--no-midi", "--fast", "--analyze-seconds", "--thumbnails",
+		"--relative", "--link-mode", "--atomic", "--no-op", "--stats", "--playlist", "--playlists-only",
+	},
+}
+
+// globalFlags are accepted by every command.
+var globalFlags = []string{"--output", "--config", "--debug", "--trace", "--log-format", "--log-file", "--quiet", "--help"}
+
+var flagAliases = map[string]string{
+	"-o": "--output", "-s": "--source", "-v": "--debug", "-vv": "--trace",
+	"-r": "--relative", "-n": "--no-op", "-m": "--no-midi", "-f": "--fast",
+	"-h": "--help", "-q": "--quiet", "-k": "--key", "-t": "--tempo",
+}
+
+var flagHelp = map[string]string{
+	"--output":             "--output, -o        output directory",
+	"--config":             "--config PATH       load settings from PATH instead of searching for " + configName,
+	"--source":             "--source, -s DIR    (required) source directory, repeatable, LABEL=DIR names the root",
+	"--include":            "--include PATTERN   only scan files matching PATTERN, repeatable",
+	"--exclude":            "--exclude PATTERN   skip files and directories matching PATTERN, repeatable",
+	"--no-default-ignores": "--no-default-ignores do not skip macOS resource forks, VCS and DAW project folders",
+	"--follow-symlinks":    "--follow-symlinks   descend into symlinked directories, loops and duplicates are skipped",
+	"--debug":              "--debug, -v         enable debug output",
+	"--log-format":         "--log-format FORMAT console (default) or json, one object per line",
+	"--log-file":           "--log-file PATH     also append the log to PATH as JSON lines",
+	"--quiet":              "--quiet, -q         don't print the banner or progress",
+	"--trace":              "--trace, -vv        enable trace output",
+	"--relative":           "--relative, -r      enable relative pathing",
+	"--link-mode":          "--link-mode MODE    symlink (default), hardlink, reflink or copy; hardlink and reflink fall back to symlink per file when impossible",
+	"--atomic":             "--atomic            build the library in a staging directory next to the output and swap it in when done",
+	"--stats":              "--stats             only output stats, no symlinking",
+	"--debounce":           "--debounce DURATION wait until changes settle for DURATION before acting on them (default: 2s)",
+	"--playlist":           "--playlist FORMAT   also write an m3u8 or xspf playlist of every view to Playlists/, repeatable",
+	"--playlists-only":     "--playlists-only    write playlists (m3u8 unless --playlist says otherwise) but no symlinks",
+	"--no-op":              "--no-op, -n         simulate actions only, change nothing (read only)",
+	"--no-midi":            "--no-midi, -m       do not parse MIDI files",
+	"--fast":               "--fast, -f          do not parse WAV files",
+	"--analyze-seconds":    "--analyze-seconds N seconds of audio to analyze for key/BPM (default: 10)",
+	"--thumbnails":         "--thumbnails        also render waveform and spectrogram thumbnails into " + StateDir + "/thumbs",
+	"--key":                "--key, -k KEY       only samples in KEY, e.g. \"A minor\"",
+	"--tempo":              "--tempo, -t BPM     only samples at BPM",
+	"--type":               "--type TYPE         only samples of TYPE (" + typeList + ")",
+	"--timesig":            "--timesig SIG       only MIDI files in time signature SIG, e.g. 6/8",
+	"--bars":               "--bars N            only MIDI files N bars long",
+	"--instrument":         "--instrument NAME   only MIDI files played on a General MIDI family, e.g. \"synth lead\"",
+	"--range":              "--range FIELD=LO..HI only samples with FIELD in range, either end may be left open, repeatable",
+	"--sort":               "--sort FIELD        sort by FIELD, -FIELD for descending",
+	"--format":             "--format FORMAT     json, ndjson or csv; query also takes paths (its default) and none",
+	"--link":               "--link DIR          also symlink every result into DIR",
+	"--file":               "--file PATH         write to PATH instead of stdout",
+	"--query":              "--query NAME=EXPR   save the query EXPR as NAME, mount shows it as Queries/NAME, repeatable",
+	"--peaks":              "--peaks             include waveform peaks (json and ndjson only), rendering missing ones",
+	"--listen":             "--listen ADDR       address to serve on (default: 127.0.0.1:8377), anything but localhost exposes your files",
+	"--help":               "--help, -h          it me",
+}
+
+const typeList = "loop, oneshot, melodic, drum, midi, ..."
+
+const exportHelp = `
+FORMAT defaults to what the --file extension says (.csv, .ndjson or .jsonl), json otherwise.
+every format carries the same fields: path, name, source, modified, types, drum, duration,
+tempo and key with where they came from and the other candidates, wav metadata, midi details
+and categories, the view directories a sample is linked into. json wraps them as
+{"schema": 1, "samples": [...]}, the schema number only changes when a field is renamed,
+removed or changes meaning. csv joins lists with ";" and prefixes midi columns with midi_.
+--peaks adds each wav's waveform to json and ndjson as peaks, in the json format of audiowaveform
+that peaks.js and friends read.
+`
+
+const queryHelp = `
+EXPRESSION compares fields to values, e.g.
+
+    keepr query 'type=loop and key~"A minor" and tempo=138..142 and bars>4'
+
+operators:  = != < <= > >=, and ~ for compatible keys, substrings of text and globs
+ranges:     tempo=138..142, duration=..2s, density=8..
+combine:    and, or, not, && || !, parentheses; terms next to each other are and'ed
+fields:     key, type, kind (drums, chords, melody, bass), drum (kick, snare, hihat, ...),
+            path and name (globs), source, artist, genre, title, software, progression,
+            timesig, instrument and every FIELD above
+`
+
+// fieldList mirrors collect.FieldNames, which we can't import from here.
+const fieldList = "tempo, duration, name, path, and for MIDI files bars, notes, lowest, highest, range,\n" +
+	"density (notes per bar), velocity, swing (50 is straight), offgrid, polyphony and maxpolyphony"
+
+func lookupCommand(name string) *command {
+	for _, c := range commands {
+		if c.name == name {
+			return c
+		}
+	}
+	return nil
+}
+
+func (c *command) accepts(flag string) bool {
+	for _, f := range append(c.flags, globalFlags...) {
+		if f == flag {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *command) help() string {
+	var b strings.Builder
+	if c.name == "" {
+		b.WriteString("\nusage: keepr <command> [flags]\n\n           Commands:\n\n")
+		for _, sub := range commands {
+			b.WriteString(fmt.Sprintf("%-10s %s\n", sub.name, sub.summary))
+		}
+		b.WriteString("\nrun 'keepr <command> --help' for command specific flags.\n")
+		b.WriteString("without a command keepr will " + c.summary + ".\n")
+	} else {
+		b.WriteString(fmt.Sprintf("\nusage: keepr %s [flags]", c.name))
+		if c.args != "" {
+			b.WriteString(" " + c.args)
+		}
+		b.WriteString("\n\n" + c.summary + "\n")
+	}
+	b.WriteString("\n           Flags:\n\n")
+	for _, f := range append(c.flags, globalFlags...) {
+		b.WriteString(flagHelp[f] + "\n")
+	}
+	if c.accepts("--sort") {
+		b.WriteString("\nFIELD is one of " + fieldList + ".\n")
+	}
+	if c.name == "query" {
+		b.WriteString(queryHelp)
+	}
+	if c.name == "export" {
+		b.WriteString(exportHelp)
+	}
+	b.WriteString("\nevery flag can also be set in " + configName + " (output directory or $XDG_CONFIG_HOME/keepr/)\n")
+	b.WriteString("using its long name as the key, or with a " + envPrefix + "* environment variable, e.g. " + envName("--analyze-seconds") + ".\n")
+	b.WriteString("flags take precedence over the environment, which takes precedence over the config file.\n\n")
+	return b.String()
+}
+
+func usage(c *command) {
+	_, _ = os.Stdout.WriteString(c.help())
+}
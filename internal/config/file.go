@@ -0,0 +1,218 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+
+	"git.tcp.direct/kayos/keepr/internal/util"
+)
+
+// configName is the file name we look for in the output directory and in $XDG_CONFIG_HOME/keepr/.
+const configName = "keepr.yml"
+
+// envPrefix prefixes environment overrides, e.g. KEEPR_ANALYZE_SECONDS for --analyze-seconds.
+const envPrefix = "KEEPR_"
+
+// repeatFlags may be given more than once, their environment variables
+// hold several values separated by os.PathListSeparator.
+var repeatFlags = map[string]struct{}{"--source": {}, "--include": {}, "--exclude": {}, "--range": {}, "--playlist": {}, "--query": {}}
+
+// valueFlags are the flags that take an argument, all others are booleans.
+var valueFlags = map[string]struct{}{
+	"--output": {}, "--source": {}, "--analyze-seconds": {}, "--key": {},
+	"--tempo": {}, "--type": {}, "--file": {}, "--config": {},
+	"--timesig": {}, "--bars": {}, "--instrument": {}, "--range": {}, "--sort": {},
+	"--format": {}, "--link": {}, "--playlist": {}, "--debounce": {},
+	"--listen": {}, "--query": {}, "--link-mode": {}, "--include": {}, "--exclude": {},
+	"--log-format": {}, "--log-file": {},
+}
+
+func envName(flag string) string {
+	return envPrefix + strings.ToUpper(strings.ReplaceAll(strings.TrimPrefix(flag, "--"), "-", "_"))
+}
+
+// lookup returns the values for flag in order of precedence: command line, environment, config file.
+func lookup(flag string, fromFlags, fromFile map[string][]string) []string {
+	if values, ok := fromFlags[flag]; ok {
+		return values
+	}
+	if value, ok := os.LookupEnv(envName(flag)); ok {
+		if _, repeat := repeatFlags[flag]; repeat {
+			return filepath.SplitList(value)
+		}
+		return []string{value}
+	}
+	return fromFile[flag]
+}
+
+// findConfig returns the path of the config file to load, or an empty string if there is none.
+// An explicitly requested (--config or KEEPR_CONFIG) file must exist, the default locations may not.
+func findConfig() (string, error) {
+	if ConfigFile != "" {
+		if _, err := os.Stat(ConfigFile); err != nil {
+			return "", err
+		}
+		return ConfigFile, nil
+	}
+	candidates := []string{filepath.Join(util.APath(Output), configName)}
+	if dir, err := os.UserConfigDir(); err == nil {
+		candidates = append(candidates, filepath.Join(dir, "keepr", configName))
+	}
+	for _, path := range candidates {
+		if _, err := os.Stat(path); err == nil {
+			return path, nil
+		}
+	}
+	return "", nil
+}
+
+// fileConfig holds the settings read from a config file.
+type fileConfig struct {
+	settings map[string][]string
+	sources  []*SourceRoot
+}
+
+// loadConfig reads a YAML config file whose keys are the long flag names, e.g.:
+//
+//	source:
+//	  - /mnt/samples
+//	  - path: /mnt/drive-b/packs
+//	    label: drive-b
+//	    exclude: ["Ableton Project Info", "*.asd"]
+//	analyze-seconds: 20
+//	relative: true
+//	query:
+//	  Dark Pads: type=loop key="A minor" tempo<100
+func loadConfig(path string) (*fileConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	raw := make(map[string]interface{})
+	if err = yaml.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	fc := &fileConfig{settings: make(map[string][]string)}
+	settings := fc.settings
+	for k, v := range raw {
+		flag := "--" + strings.ReplaceAll(strings.ToLower(k), "_", "-")
+		if _, known := flagHelp[flag]; !known || flag == "--help" || flag == "--config" {
+			return nil, fmt.Errorf("%s: unknown setting %q", path, k)
+		}
+		if flag == "--source" {
+			if fc.sources, err = parseSources(v); err != nil {
+				return nil, fmt.Errorf("%s: %w", path, err)
+			}
+			continue
+		}
+		switch vv := v.(type) {
+		case map[interface{}]interface{}:
+			if flag != "--query" {
+				return nil, fmt.Errorf("%s: %s can't be a mapping", path, k)
+			}
+			for name, expr := range vv {
+				settings[flag] = append(settings[flag], fmt.Sprint(name)+"="+fmt.Sprint(expr))
+			}
+		case []interface{}:
+			for _, item := range vv {
+				settings[flag] = append(settings[flag], fmt.Sprint(item))
+			}
+		case nil:
+		default:
+			settings[flag] = []string{fmt.Sprint(vv)}
+		}
+	}
+	return fc, nil
+}
+
+// parseSources reads the source setting, which is a single path or a list of
+// paths and/or mappings with path, label and exclude keys.
+func parseSources(v interface{}) ([]*SourceRoot, error) {
+	items, ok := v.([]interface{})
+	if !ok {
+		items = []interface{}{v}
+	}
+	var roots []*SourceRoot
+	for _, item := range items {
+		switch entry := item.(type) {
+		case string:
+			roots = append(roots, parseSourceRoot(entry))
+		case map[interface{}]interface{}:
+			data, _ := yaml.Marshal(entry)
+			root := &SourceRoot{}
+			if err := yaml.UnmarshalStrict(data, root); err != nil {
+				return nil, fmt.Errorf("bad source entry: %w", err)
+			}
+			roots = append(roots, root)
+		default:
+			return nil, fmt.Errorf("bad source entry: %v", entry)
+		}
+	}
+	return roots, nil
+}
+
+// resolve applies settings for every flag cmd accepts, with flags taking
+// precedence over KEEPR_* environment variables, which take precedence over the config file.
+func resolve(cmd *command, fromFlags map[string][]string) error {
+	// the config file may live in the output directory, so settle those two first.
+	for _, flag := range []string{"--config", "--output"} {
+		for _, v := range lookup(flag, fromFlags, nil) {
+			if err := set(flag, v); err != nil {
+				return err
+			}
+		}
+	}
+
+	path, err := findConfig()
+	if err != nil {
+		return fmt.Errorf("failed to find config file: %w", err)
+	}
+	fc := &fileConfig{}
+	if path != "" {
+		if fc, err = loadConfig(path); err != nil {
+			return err
+		}
+		ConfigFile = path
+		log.Debug().Str("path", path).Msg("loaded config file")
+	}
+
+	var errs []error
+	for _, flag := range append(cmd.flags, globalFlags...) {
+		if flag == "--help" || flag == "--config" {
+			continue
+		}
+		if flag == "--output" {
+			if _, overridden := fromFlags[flag]; overridden {
+				continue
+			}
+			if _, overridden := os.LookupEnv(envName(flag)); overridden {
+				continue
+			}
+		}
+		if flag == "--source" {
+			if values := lookup(flag, fromFlags, nil); len(values) > 0 {
+				fc.sources = nil
+				for _, v := range values {
+					fc.sources = append(fc.sources, parseSourceRoot(v))
+				}
+			}
+			for _, root := range fc.sources {
+				if err = addSource(root); err != nil {
+					errs = append(errs, err)
+				}
+			}
+			continue
+		}
+		for _, v := range lookup(flag, fromFlags, fc.settings) {
+			if err = set(flag, v); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
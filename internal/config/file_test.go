@@ -0,0 +1,102 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeConfig(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), configName)
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadConfig(t *testing.T) {
+	path := writeConfig(t, "source: /mnt/samples\nanalyze_seconds: 20\nrelative: true\n")
+	fc, err := loadConfig(path)
+	if err != nil {
+		t.Fatalf("loadConfig() error = %v", err)
+	}
+	if len(fc.sources) != 1 || fc.sources[0].Path != "/mnt/samples" {
+		t.Errorf("sources = %v, want [/mnt/samples]", fc.sources)
+	}
+	settings := fc.settings
+	want := map[string]string{
+		"--analyze-seconds": "20",
+		"--relative":        "true",
+	}
+	for flag, value := range want {
+		if got := settings[flag]; len(got) != 1 || got[0] != value {
+			t.Errorf("settings[%s] = %v, want [%s]", flag, got, value)
+		}
+	}
+}
+
+func TestLoadConfig_Sources(t *testing.T) {
+	fc, err := loadConfig(writeConfig(t, `source:
+  - /mnt/a
+  - drums=/mnt/b
+  - path: /mnt/c/packs
+    label: drive-c
+    exclude: ["Ableton Project Info", "*.asd"]
+`))
+	if err != nil {
+		t.Fatalf("loadConfig() error = %v", err)
+	}
+	if len(fc.sources) != 3 {
+		t.Fatalf("got %d sources, want 3", len(fc.sources))
+	}
+	if fc.sources[1].Label != "drums" || fc.sources[1].Path != "/mnt/b" {
+		t.Errorf("label=path entry parsed as %+v", fc.sources[1])
+	}
+	c := fc.sources[2]
+	if c.Label != "drive-c" || c.Path != "/mnt/c/packs" || len(c.Exclude) != 2 {
+		t.Errorf("mapping entry parsed as %+v", c)
+	}
+}
+
+func TestLoadConfig_Unknown(t *testing.T) {
+	if _, err := loadConfig(writeConfig(t, "bogus: 1\n")); err == nil {
+		t.Error("loadConfig() should reject unknown settings")
+	}
+}
+
+func TestLookup_Precedence(t *testing.T) {
+	fromFile := map[string][]string{"--source": {"file"}}
+	fromFlags := map[string][]string{"--source": {"flag"}}
+
+	t.Setenv(envName("--source"), "env")
+	if got := lookup("--source", fromFlags, fromFile); got[0] != "flag" {
+		t.Errorf("flags should win, got %v", got)
+	}
+	if got := lookup("--source", nil, fromFile); got[0] != "env" {
+		t.Errorf("environment should beat the config file, got %v", got)
+	}
+	os.Unsetenv(envName("--source"))
+	if got := lookup("--source", nil, fromFile); got[0] != "file" {
+		t.Errorf("config file should be used as a last resort, got %v", got)
+	}
+}
+
+func TestAddSource_Label(t *testing.T) {
+	defer func(s []*SourceRoot) { Sources = s }(Sources)
+	Sources = nil
+	dir := t.TempDir()
+	for _, label := range []string{"drums/kicks", `drums\kicks`, ".", "..", "  "} {
+		if err := addSource(&SourceRoot{Path: dir, Label: label}); err == nil {
+			t.Errorf("label %q should be rejected", label)
+		}
+	}
+	for _, label := range []string{"drums", "drums"} {
+		if err := addSource(&SourceRoot{Path: dir, Label: label}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(Sources) != 2 || Sources[1].Label != "drums-2" {
+		t.Errorf("sources = %+v, want drums and drums-2", Sources)
+	}
+}
@@ -1,9 +1,11 @@
 package config
 
 import (
-	"bytes"
+	"errors"
+	"fmt"
 	"io"
 	"os"
+	"path/filepath"
 	"strconv"
 	"strings"
 	"time"
@@ -11,22 +13,81 @@ import (
 	"github.com/rs/zerolog"
 
 	"git.tcp.direct/kayos/keepr/internal/art"
+	"git.tcp.direct/kayos/keepr/internal/progress"
+	"git.tcp.direct/kayos/keepr/internal/util"
 )
 
 const defDestination = "001-LINKED_SORTED_DIRECTORIES"
 
+// StateDir is the directory inside Output where keepr keeps its own files, such as the catalog.
+const StateDir = ".keepr"
+
 var (
-	log    zerolog.Logger
-	Source = ""
+	log zerolog.Logger
+	// Command is the subcommand we were invoked with, empty when run without one.
+	Command = ""
+	// Args holds positional arguments left over after flag parsing.
+	Args []string
+	// Sources are the directory trees we walk for samples.
+	Sources []*SourceRoot
+	// Include and Exclude hold walker filter patterns applied to every source root.
+	Include []string
+	Exclude []string
+	// FollowSymlinks makes scan descend into symlinked directories.
+	FollowSymlinks = false
+	// NoDefaultIgnores disables the built in ignore list, see filter.Builtin.
+	NoDefaultIgnores = false
 	// Output is the base path for our symlink library.
 	Output = defDestination
 	// Relative will determine if we use relative pathing for symlinks.
-	Relative      = false
-	Simulate      = false
-	StatsOnly     = false
-	NoMIDI        = false
-	SkipWavDecode   = false
-	AnalyzeSeconds  = 10
+	Relative = false
+	// LinkMode is how views hold samples: symlink, hardlink, reflink or copy.
+	LinkMode = "symlink"
+	// Atomic makes link build the library next to Output and swap it in when done.
+	Atomic    = false
+	Simulate  = false
+	StatsOnly = false
+	// Playlists are the playlist formats link writes besides, or with PlaylistsOnly instead of, symlinks.
+	Playlists      []string
+	PlaylistsOnly  = false
+	NoMIDI         = false
+	SkipWavDecode  = false
+	AnalyzeSeconds = 10
+	// Thumbnails makes analysis render waveform and spectrogram thumbnails, see collect.Thumbnails.
+	Thumbnails = false
+	// ExportPeaks makes export include the waveform peaks of every sample.
+	ExportPeaks = false
+	// Debounce is how long watch waits for things to settle before acting on changes.
+	Debounce = 2 * time.Second
+	// QueryKey, QueryTempo and QueryType narrow down the results of the query command.
+	QueryKey   = ""
+	QueryTempo = 0
+	QueryType  = ""
+	// QueryTimeSig, QueryBars and QueryInstrument narrow them down to matching MIDI files.
+	QueryTimeSig    = ""
+	QueryBars       = 0
+	QueryInstrument = ""
+	// Ranges and SortBy filter and order query and export output by numeric sample fields.
+	Ranges []string
+	SortBy = ""
+	// Format is the output format of query and export.
+	Format = ""
+	// LinkDir is where query links its results, if anywhere.
+	LinkDir = ""
+	// Queries are saved queries by name, mount shows each as a view under Queries/.
+	Queries = make(map[string]string)
+	// ExportFile is where export writes to, stdout when empty.
+	ExportFile = ""
+	// Listen is the address serve listens on.
+	Listen = "127.0.0.1:8377"
+	// LogFormat is how the log is written to stdout, console or json.
+	LogFormat = "console"
+	// LogFile is where the log is also appended to as JSON, if anywhere.
+	LogFile = ""
+	// Quiet leaves out the banner and progress output.
+	Quiet = false
+	// ConfigFile is the config file we loaded settings from, if any.
+	ConfigFile = ""
 )
 
 // GetLogger retrieves a pointer to our zerolog instance.
@@ -34,119 +95,294 @@ func GetLogger() *zerolog.Logger {
 	return &log
 }
 
-func required(i int) {
-	if !(len(os.Args) < i) {
-		return
-	}
-	println("invalid syntax, missing argument")
-	os.Exit(1)
+// StatePath joins elem onto our state directory inside Output.
+func StatePath(elem ...string) string {
+	return filepath.Join(append([]string{Output, StateDir}, elem...)...)
 }
 
-var helpStr = `
-           Flags:
+// CatalogPath is where scan saves, and every other command loads, the catalog.
+func CatalogPath() string {
+	return StatePath("catalog.json")
+}
 
---output, -o     (required) output directory
---source, -s     (required) source directory
+func required(args []string, i int, cmd *command) string {
+	if i+1 < len(args) {
+		return args[i+1]
+	}
+	println("invalid syntax, missing argument for " + args[i])
+	usage(cmd)
+	os.Exit(1)
+	return ""
+}
 
---debug, -v      enable debug output
---trace, -vv     enable trace output
---relative, -r   enable relative pathing
---stats          only output stats, no symlinking
---no-op, -n      simulate actions only, change nothing (read only)
---no-midi, -m    do not parse MIDI files
---fast, -f       do not parse WAV files
+// set applies a single flag value, regardless of whether it came from
+// the command line, the environment or a config file.
+func set(flag, value string) error {
+	on := func() (bool, error) {
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return false, fmt.Errorf("%s expects true or false, got %q", flag, value)
+		}
+		return b, nil
+	}
+	var err error
+	switch flag {
+	case "--output":
+		Output = value
+	case "--debug":
+		var b bool
+		if b, err = on(); b && zerolog.GlobalLevel() > zerolog.DebugLevel {
+			zerolog.SetGlobalLevel(zerolog.DebugLevel)
+		}
+	case "--trace":
+		var b bool
+		if b, err = on(); b {
+			zerolog.SetGlobalLevel(zerolog.TraceLevel)
+		}
+	case "--relative":
+		Relative, err = on()
+	case "--link-mode":
+		switch mode := strings.ToLower(value); mode {
+		case "symlink", "hardlink", "reflink", "copy":
+			LinkMode = mode
+		default:
+			return fmt.Errorf("unknown link mode %q, want symlink, hardlink, reflink or copy", value)
+		}
+	case "--atomic":
+		Atomic, err = on()
+	case "--stats":
+		StatsOnly, err = on()
+	case "--playlist":
+		format := strings.ToLower(strings.TrimPrefix(value, "."))
+		if format == "m3u" {
+			format = "m3u8"
+		}
+		if format != "m3u8" && format != "xspf" {
+			return fmt.Errorf("unknown playlist format %q, want m3u8 or xspf", value)
+		}
+		Playlists = append(Playlists, format)
+	case "--playlists-only":
+		PlaylistsOnly, err = on()
+	case "--no-op":
+		Simulate, err = on()
+	case "--no-midi":
+		NoMIDI, err = on()
+	case "--fast":
+		SkipWavDecode, err = on()
+	case "--analyze-seconds":
+		secs, aerr := strconv.Atoi(value)
+		if aerr != nil || secs < 1 {
+			return errors.New("--analyze-seconds requires a positive integer")
+		}
+		AnalyzeSeconds = secs
+	case "--thumbnails":
+		Thumbnails, err = on()
+	case "--peaks":
+		ExportPeaks, err = on()
+	case "--debounce":
+		d, derr := time.ParseDuration(value)
+		if derr != nil || d <= 0 {
+			return errors.New("--debounce requires a positive duration, e.g. 2s")
+		}
+		Debounce = d
+	case "--include":
+		Include = append(Include, value)
+	case "--exclude":
+		Exclude = append(Exclude, value)
+	case "--follow-symlinks":
+		FollowSymlinks, err = on()
+	case "--no-default-ignores":
+		NoDefaultIgnores, err = on()
+	case "--key":
+		QueryKey = value
+	case "--tempo":
+		tempo, terr := strconv.Atoi(value)
+		if terr != nil || tempo < 1 {
+			return errors.New("--tempo requires a positive integer")
+		}
+		QueryTempo = tempo
+	case "--type":
+		QueryType = value
+	case "--timesig":
+		QueryTimeSig = value
+	case "--bars":
+		bars, berr := strconv.Atoi(value)
+		if berr != nil || bars < 1 {
+			return errors.New("--bars requires a positive integer")
+		}
+		QueryBars = bars
+	case "--instrument":
+		QueryInstrument = value
+	case "--range":
+		Ranges = append(Ranges, value)
+	case "--sort":
+		SortBy = value
+	case "--format":
+		Format = strings.ToLower(value)
+	case "--link":
+		LinkDir = util.APath(value)
+	case "--query":
+		name, expr, ok := strings.Cut(value, "=")
+		name = strings.TrimSpace(name)
+		if !ok || name == "" || strings.ContainsAny(name, `/\`) || strings.TrimSpace(expr) == "" {
+			return fmt.Errorf("bad saved query %q, want NAME=EXPRESSION", value)
+		}
+		Queries[name] = expr
+	case "--file":
+		ExportFile = value
+	case "--listen":
+		Listen = value
+	case "--config":
+		ConfigFile = value
+	case "--log-format":
+		switch format := strings.ToLower(value); format {
+		case "console", "json":
+			LogFormat = format
+		default:
+			return fmt.Errorf("unknown log format %q, want console or json", value)
+		}
+	case "--log-file":
+		LogFile = value
+	case "--quiet":
+		Quiet, err = on()
+	}
+	return err
+}
 
---help, -h       it me
---analyze-seconds N  seconds of audio to analyze for key/BPM (default: 10)
+// consoleWriter writes the log for humans, with the path field of an event up front like a caller.
+func consoleWriter() zerolog.ConsoleWriter {
+	return zerolog.NewConsoleWriter(func(w *zerolog.ConsoleWriter) {
+		w.Out = logOut
+		w.TimeFormat = time.RFC822
+		w.PartsOrder = []string{zerolog.TimestampFieldName, zerolog.LevelFieldName, zerolog.CallerFieldName, "path", zerolog.MessageFieldName}
+		w.FieldsExclude = []string{"path"}
+		w.FormatPartValueByName = func(i interface{}, name string) string {
+			p, _ := i.(string)
+			if name != "path" || p == "" {
+				return ""
+			}
+			if cwd, err := os.Getwd(); err == nil {
+				if rel, err := filepath.Rel(cwd, p); err == nil {
+					p = rel
+				}
+			}
+			return "\x1b[1m" + p + "\x1b[0m\x1b[36m >\x1b[0m"
+		}
+	})
+}
 
-`
+// logOut is where the log goes, stdout being kept for the results of query and export.
+var logOut io.Writer = os.Stderr
 
-func help() {
-	rdr := bytes.NewReader([]byte(helpStr))
-	io.Copy(os.Stdout, rdr)
+// setupLogging replaces the logger KeeprInit starts out with by the one asked for.
+func setupLogging() error {
+	out := logOut
+	if LogFormat == "console" {
+		out = consoleWriter()
+	}
+	out = progress.Wrap(out)
+	if LogFile != "" {
+		f, err := os.OpenFile(util.APath(LogFile), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+		if err != nil {
+			return fmt.Errorf("failed to open log file: %w", err)
+		}
+		out = zerolog.MultiLevelWriter(out, f)
+	}
+	log = zerolog.New(out).With().Timestamp().Logger()
+	return nil
 }
 
 func KeeprInit() {
-	println(art.String())
-
 	zerolog.SetGlobalLevel(zerolog.InfoLevel)
 
-	log = zerolog.New(zerolog.NewConsoleWriter(func(w *zerolog.ConsoleWriter) {
-		w.TimeFormat = time.RFC822
-	})).With().Timestamp().Logger()
+	log = zerolog.New(consoleWriter()).With().Timestamp().Logger()
 
-	for i, arg := range os.Args {
-		if i == 0 {
-			continue
-		}
-		switch arg {
-		case "_":
-			continue
-		case "-o", "--output":
-			required(i)
-			Output = os.Args[i+1]
-			os.Args[i+1] = "_"
-		case "--debug", "-v":
-			zerolog.SetGlobalLevel(zerolog.DebugLevel)
-		case "--trace", "-vv":
-			zerolog.SetGlobalLevel(zerolog.TraceLevel)
-		case "--relative", "-r":
-			Relative = true
-		case "--stats":
-			StatsOnly = true
-		case "--no-op", "-n":
-			Simulate = true
-		case "--no-midi", "-m":
-			NoMIDI = true
-		case "--fast", "-f":
-			SkipWavDecode = true
-		case "--analyze-seconds":
-			required(i + 1)
-			if secs, err := strconv.Atoi(os.Args[i+1]); err == nil && secs > 0 {
-				AnalyzeSeconds = secs
-				os.Args[i+1] = "_"
+	args := os.Args[1:]
+	cmd := legacy
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		if args[0] == "help" {
+			if len(args) > 1 && lookupCommand(args[1]) != nil {
+				usage(lookupCommand(args[1]))
 			} else {
-				log.Fatal().Msg("--analyze-seconds requires a positive integer")
+				usage(legacy)
 			}
-		case "--source", "-s":
-			required(i)
-			Source = os.Args[i+1]
-			os.Args[i+1] = "_"
-		case "--help", "-h":
-			help()
 			os.Exit(0)
-		default:
-			log.Fatal().Msg("unknown argument: " + arg)
-			help()
 		}
+		if cmd = lookupCommand(args[0]); cmd == nil {
+			log.Error().Msg("unknown command: " + args[0])
+			usage(legacy)
+			os.Exit(1)
+		}
+		args = args[1:]
 	}
+	Command = cmd.name
 
-	if Source == "" {
+	fromFlags := make(map[string][]string)
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if !strings.HasPrefix(arg, "-") {
+			Args = append(Args, arg)
+			continue
+		}
+		if alias, ok := flagAliases[arg]; ok {
+			arg = alias
+		}
+		if !cmd.accepts(arg) {
+			log.Error().Msg("unknown argument: " + args[i])
+			usage(cmd)
+			os.Exit(1)
+		}
+		if arg == "--help" {
+			usage(cmd)
+			os.Exit(0)
+		}
+		value := "true"
+		if _, ok := valueFlags[arg]; ok {
+			value = required(args, i, cmd)
+			i++
+		}
+		fromFlags[arg] = append(fromFlags[arg], value)
+	}
+
+	if err := resolve(cmd, fromFlags); err != nil {
+		log.Error().Err(err).Msg("invalid configuration")
+		usage(cmd)
+		os.Exit(1)
+	}
+	if err := setupLogging(); err != nil {
+		log.Fatal().Err(err).Msg("")
+	}
+	if !Quiet {
+		println(art.String())
+	}
+
+	if cmd.accepts("--source") && len(Sources) == 0 {
 		log.Error().Msg("missing target search directory")
-		help()
+		usage(cmd)
 		os.Exit(1)
 	}
 
+	Output = util.APath(Output)
+
+	switch Command {
+	case "", "scan", "link", "watch":
+	default:
+		// everything else only reads an existing library
+		return
+	}
+
 	f, err := os.Stat(Output)
 	switch {
 	case err != nil:
 		if !os.IsNotExist(err) {
-			log.Fatal().Caller().Str("caller", Output).Err(err).Msg("")
+			log.Fatal().Caller().Str("path", Output).Err(err).Msg("")
 		}
 		if err := os.MkdirAll(Output, os.ModePerm); err != nil {
-			log.Fatal().Caller().Str("caller", Output).Err(err).Msg("could not make directory")
+			log.Fatal().Caller().Str("path", Output).Err(err).Msg("could not make directory")
 		}
 	case !f.IsDir():
-		if Output != "./"+defDestination {
-			log.Error().Caller().Str("caller", Output).Msg("not a directory")
-			help()
-			os.Exit(1)
-		}
-		if err := os.MkdirAll(Output, os.ModePerm); err != nil {
-			log.Fatal().Caller().Str("caller", Output).Err(err).Msg("could not make directory")
-		}
-	}
-	if !strings.HasSuffix(Output, "/") {
-		Output = Output + "/"
+		log.Error().Caller().Str("path", Output).Msg("not a directory")
+		usage(cmd)
+		os.Exit(1)
 	}
 }
@@ -0,0 +1,38 @@
+package config
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSetupLogging(t *testing.T) {
+	defer func(format, file string) { LogFormat, LogFile = format, file }(LogFormat, LogFile)
+	if err := set("--log-format", "xml"); err == nil {
+		t.Error("set() should reject unknown log formats")
+	}
+	if err := set("--log-format", "JSON"); err != nil || LogFormat != "json" {
+		t.Fatalf("log format %q, %v", LogFormat, err)
+	}
+	LogFile = filepath.Join(t.TempDir(), "keepr.log")
+	if err := setupLogging(); err != nil {
+		t.Fatal(err)
+	}
+	if consoleWriter().Out != os.Stderr {
+		t.Error("console log doesn't go to stderr")
+	}
+	log.Warn().Caller().Str("path", "/src/kick.wav").Str("phase", "analysis").Msg("test")
+
+	data, err := os.ReadFile(LogFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var event map[string]interface{}
+	if err = json.Unmarshal(data, &event); err != nil {
+		t.Fatalf("log file isn't JSON lines: %v\n%s", err, data)
+	}
+	if event["path"] != "/src/kick.wav" || event["phase"] != "analysis" || event["caller"] == nil {
+		t.Errorf("fields missing from %s", data)
+	}
+}
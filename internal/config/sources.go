@@ -0,0 +1,66 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"git.tcp.direct/kayos/keepr/internal/util"
+)
+
+// SourceRoot is a directory tree we walk for samples.
+type SourceRoot struct {
+	// Path is the directory to walk.
+	Path string `yaml:"path"`
+	// Label names the root in the Sources view, defaults to the last element of Path.
+	Label string `yaml:"label"`
+	// Exclude holds patterns for files and directories to skip under this root only, see --exclude.
+	Exclude []string `yaml:"exclude"`
+}
+
+// parseSourceRoot parses a --source value, either "path" or "label=path".
+func parseSourceRoot(value string) *SourceRoot {
+	root := &SourceRoot{Path: value}
+	if label, path, ok := strings.Cut(value, "="); ok && label != "" && !strings.ContainsAny(label, `/\`) {
+		root.Label, root.Path = label, path
+	}
+	return root
+}
+
+// addSource appends root to Sources, making sure it has a valid and unique label.
+func addSource(root *SourceRoot) error {
+	if strings.TrimSpace(root.Path) == "" {
+		return fmt.Errorf("source root with label %q has no path", root.Label)
+	}
+	root.Path = util.APath(root.Path)
+	if f, err := os.Stat(root.Path); err != nil {
+		return fmt.Errorf("bad source %s: %w", root.Path, err)
+	} else if !f.IsDir() {
+		return fmt.Errorf("bad source %s: not a directory", root.Path)
+	}
+	if root.Label == "" {
+		root.Label = filepath.Base(root.Path)
+	}
+	// the label is a directory of the Sources view
+	if label := strings.TrimSpace(root.Label); label == "" || label == "." || label == ".." || strings.ContainsAny(label, `/\`) {
+		return fmt.Errorf("bad label %q for source %s: must name a single directory", root.Label, root.Path)
+	}
+	label := root.Label
+	for n := 2; ; n++ {
+		taken := false
+		for _, other := range Sources {
+			if other.Label == root.Label {
+				taken = true
+				break
+			}
+		}
+		if !taken {
+			break
+		}
+		root.Label = label + "-" + strconv.Itoa(n)
+	}
+	Sources = append(Sources, root)
+	return nil
+}
@@ -0,0 +1,187 @@
+// Package filter decides which files and directories under a source root get walked.
+package filter
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"strings"
+	"sync"
+)
+
+// IgnoreFile is the name of the per directory ignore file, it uses gitignore syntax.
+const IgnoreFile = ".keeprignore"
+
+// Builtin are ignored unless disabled, mostly resource forks, OS metadata and DAW project junk.
+var Builtin = []string{
+	"__MACOSX/",
+	"._*",
+	".DS_Store",
+	".AppleDouble/",
+	".Spotlight-V100/",
+	".Trashes/",
+	".Trash-*/",
+	"$RECYCLE.BIN/",
+	"System Volume Information/",
+	"Thumbs.db",
+	"desktop.ini",
+	".git/",
+	".svn/",
+	".hg/",
+	"Ableton Project Info/",
+	"**/*Project/Backup/",
+	"*.asd",
+	"**/Samples/Processed/",
+	"*.nosync/",
+}
+
+// Filter holds include, exclude and ignore rules for a single source root.
+type Filter struct {
+	fsys    fs.FS
+	base    string
+	builtin []*rule
+	include []*rule
+	exclude []*rule
+
+	ignores map[string][]*rule
+	warn    func(error)
+	mu      *sync.Mutex
+}
+
+// Options configure a Filter.
+type Options struct {
+	// Include, when not empty, limits files to those matching at least one pattern.
+	Include []string
+	// Exclude skips anything matching one of its patterns, regardless of ignore files.
+	Exclude []string
+	// NoBuiltin disables the Builtin ignore list.
+	NoBuiltin bool
+	// Warn, if set, is called with problems found in ignore files.
+	Warn func(error)
+}
+
+// New creates a Filter for the source root at base inside fsys.
+func New(fsys fs.FS, base string, opts Options) (*Filter, error) {
+	f := &Filter{
+		fsys:    fsys,
+		base:    base,
+		ignores: make(map[string][]*rule),
+		warn:    opts.Warn,
+		mu:      &sync.Mutex{},
+	}
+	var errs []error
+	if !opts.NoBuiltin {
+		for _, p := range Builtin {
+			r, err := parseRule(p)
+			if err != nil {
+				panic(err)
+			}
+			f.builtin = append(f.builtin, r)
+		}
+	}
+	for _, p := range opts.Include {
+		r, err := parsePattern(p)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("include: %w", err))
+			continue
+		}
+		f.include = append(f.include, r)
+	}
+	for _, p := range opts.Exclude {
+		r, err := parsePattern(p)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("exclude: %w", err))
+			continue
+		}
+		f.exclude = append(f.exclude, r)
+	}
+	return f, errors.Join(errs...)
+}
+
+// Skip reports whether rel, a slash separated path relative to the source root, should be
+// skipped, along with a short reason for logging. Skipped directories should not be descended into.
+func (f *Filter) Skip(rel string, isDir bool) (bool, string) {
+	if rel == "" || rel == "." {
+		return false, ""
+	}
+	for _, r := range f.exclude {
+		if r.match(rel, isDir) {
+			return true, "excluded by " + r.text
+		}
+	}
+
+	// built in rules act as the outermost ignore file, so a .keeprignore can still negate them.
+	ignored, reason := false, ""
+	for _, r := range f.builtin {
+		if r.match(rel, isDir) {
+			ignored, reason = !r.negate, "built in ignore "+r.text
+		}
+	}
+	dirs := []string{""}
+	if parent := path.Dir(rel); parent != "." {
+		elems := strings.Split(parent, "/")
+		for i := range elems {
+			dirs = append(dirs, strings.Join(elems[:i+1], "/"))
+		}
+	}
+	for _, dir := range dirs {
+		sub := rel
+		if dir != "" {
+			sub = strings.TrimPrefix(rel, dir+"/")
+		}
+		for _, r := range f.ignoreRules(dir) {
+			if r.match(sub, isDir) {
+				ignored, reason = !r.negate, path.Join(dir, IgnoreFile)+": "+r.text
+			}
+		}
+	}
+	if ignored {
+		return true, reason
+	}
+	if isDir || len(f.include) == 0 {
+		return false, ""
+	}
+	for _, r := range f.include {
+		if r.match(rel, isDir) {
+			return false, ""
+		}
+	}
+	return true, "not included"
+}
+
+// ignoreRules returns the parsed .keeprignore of dir, relative to the root, reading it on first use.
+func (f *Filter) ignoreRules(dir string) []*rule {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if rules, ok := f.ignores[dir]; ok {
+		return rules
+	}
+	rules, err := f.readIgnore(path.Join(f.base, dir, IgnoreFile))
+	if err != nil && !errors.Is(err, fs.ErrNotExist) && f.warn != nil {
+		f.warn(err)
+	}
+	f.ignores[dir] = rules
+	return rules
+}
+
+func (f *Filter) readIgnore(name string) ([]*rule, error) {
+	data, err := fs.ReadFile(f.fsys, name)
+	if err != nil {
+		return nil, err
+	}
+	var rules []*rule
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		r, perr := parseRule(scanner.Text())
+		if perr != nil {
+			return rules, fmt.Errorf("%s: %w", name, perr)
+		}
+		if r != nil {
+			rules = append(rules, r)
+		}
+	}
+	return rules, scanner.Err()
+}
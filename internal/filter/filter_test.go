@@ -0,0 +1,153 @@
+package filter
+
+import (
+	"testing"
+	"testing/fstest"
+)
+
+func TestParseRule(t *testing.T) {
+	tests := []struct {
+		pattern string
+		path    string
+		isDir   bool
+		want    bool
+	}{
+		{"*.asd", "kick.wav.asd", false, true},
+		{"*.asd", "pack/kicks/kick.wav.asd", false, true},
+		{"*.asd", "kick.wav", false, false},
+		{"Backup/", "project/Backup", true, true},
+		{"Backup/", "project/Backup", false, false},
+		{"/Backup", "project/Backup", true, false},
+		{"/Backup", "Backup", true, true},
+		{"pack/*.wav", "pack/kick.wav", false, true},
+		{"pack/*.wav", "other/pack/kick.wav", false, false},
+		{"pack/*.wav", "pack/kicks/kick.wav", false, false},
+		{"**/loops", "a/b/loops", true, true},
+		{"**/loops", "loops", true, true},
+		{"pack/**", "pack/a/b.wav", false, true},
+		{"a/**/b.wav", "a/b.wav", false, true},
+		{"a/**/b.wav", "a/x/y/b.wav", false, true},
+		{"kick_0?.wav", "kick_01.wav", false, true},
+		{"kick_[!0]1.wav", "kick_01.wav", false, false},
+		{"kick_[0-9]1.wav", "kick_01.wav", false, true},
+		{`\#hash.wav`, "#hash.wav", false, true},
+		{"._*", "pack/._kick.wav", false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.pattern+" "+tt.path, func(t *testing.T) {
+			r, err := parseRule(tt.pattern)
+			if err != nil || r == nil {
+				t.Fatalf("parseRule(%q) = %v, %v", tt.pattern, r, err)
+			}
+			if got := r.match(tt.path, tt.isDir); got != tt.want {
+				t.Errorf("match(%q, %v) = %v, want %v (re: %s)", tt.path, tt.isDir, got, tt.want, r.re)
+			}
+		})
+	}
+}
+
+func TestParseRule_Blank(t *testing.T) {
+	for _, line := range []string{"", "   ", "# comment", "/"} {
+		if r, err := parseRule(line); r != nil || err != nil {
+			t.Errorf("parseRule(%q) = %v, %v, want nil, nil", line, r, err)
+		}
+	}
+}
+
+func TestFilter_Skip(t *testing.T) {
+	fsys := fstest.MapFS{
+		"lib/.keeprignore":           {Data: []byte("# junk\n*.txt\nrenders/\n!Old Project/Backup/\n")},
+		"lib/pack/.keeprignore":      {Data: []byte("!keep.txt\n/local.wav\n")},
+		"lib/pack/kick.wav":          {},
+		"lib/pack/keep.txt":          {},
+		"lib/pack/notes.txt":         {},
+		"lib/pack/local.wav":         {},
+		"lib/pack/sub/local.wav":     {},
+		"lib/pack/renders/out.wav":   {},
+		"lib/__MACOSX/pack/kick.wav": {},
+	}
+	f, err := New(fsys, "lib", Options{Exclude: []string{"re:(?i)demo"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		path  string
+		isDir bool
+		want  bool
+	}{
+		{"pack/kick.wav", false, false},
+		{"pack/notes.txt", false, true},
+		{"pack/keep.txt", false, false},
+		{"pack/local.wav", false, true},
+		{"pack/sub/local.wav", false, false},
+		{"pack/renders", true, true},
+		{"__MACOSX", true, true},
+		{"pack/._kick.wav", false, true},
+		{"Ableton Project Info", true, true},
+		{"Backup", true, false},
+		{"pack/Song Project/Backup", true, true},
+		{"Old Project/Backup", true, false},
+		{"Samples/Processed", true, true},
+		{"pack/Samples/Processed", true, true},
+		{"pack/Processed", true, false},
+		{"pack/DEMO_loop.wav", false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			got, reason := f.Skip(tt.path, tt.isDir)
+			if got != tt.want {
+				t.Errorf("Skip(%q) = %v (%s), want %v", tt.path, got, reason, tt.want)
+			}
+		})
+	}
+}
+
+func TestFilter_Include(t *testing.T) {
+	f, err := New(fstest.MapFS{}, ".", Options{Include: []string{"*.wav", "re:\\.midi?$"}, NoBuiltin: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for path, want := range map[string]bool{
+		"a/kick.wav":  false,
+		"a/chord.mid": false,
+		"a/notes.txt": true,
+		"._kick.wav":  false,
+	} {
+		if got, _ := f.Skip(path, false); got != want {
+			t.Errorf("Skip(%q) = %v, want %v", path, got, want)
+		}
+	}
+	if skip, _ := f.Skip("a", true); skip {
+		t.Error("include patterns must not stop us from descending into directories")
+	}
+}
+
+func TestNew_BadPattern(t *testing.T) {
+	if _, err := New(fstest.MapFS{}, ".", Options{Exclude: []string{"re:("}}); err == nil {
+		t.Error("New() should reject an invalid regular expression")
+	}
+	if _, err := New(fstest.MapFS{}, ".", Options{Include: []string{"!negated"}}); err == nil {
+		t.Error("New() should reject negated --include patterns")
+	}
+}
+
+func TestCompileGlob(t *testing.T) {
+	for _, tt := range []struct {
+		pattern, path string
+		want          bool
+	}{
+		{"*.wav", "/samples/pack/kick.wav", true},
+		{"kick*", "/samples/pack/kick.wav", true},
+		{"pack/*.wav", "/samples/pack/kick.wav", false},
+		{"/samples/**/kick.wav", "/samples/pack/kick.wav", true},
+		{"**/pack/*", "/samples/pack/kick.wav", true},
+	} {
+		g, err := CompileGlob(tt.pattern)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := g.Match(tt.path); got != tt.want {
+			t.Errorf("CompileGlob(%q).Match(%q) = %v, want %v", tt.pattern, tt.path, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,159 @@
+package filter
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// regexPrefix marks an --include or --exclude pattern as a regular expression
+// matched against the slash separated path relative to the source root.
+const regexPrefix = "re:"
+
+// rule is a single gitignore style pattern.
+type rule struct {
+	text    string
+	negate  bool
+	dirOnly bool
+	re      *regexp.Regexp
+}
+
+// parseRule parses a line of a .keeprignore file, returning nil for blank lines and comments.
+// The syntax follows gitignore: "!" negates, a trailing "/" only matches directories,
+// a pattern containing a "/" is relative to the directory of the ignore file while one
+// without matches at any depth, and "**" matches across directories.
+func parseRule(line string) (*rule, error) {
+	line = strings.TrimRight(line, "\r")
+	if !strings.HasSuffix(line, `\ `) {
+		line = strings.TrimRight(line, " \t")
+	}
+	if line == "" || strings.HasPrefix(line, "#") {
+		return nil, nil
+	}
+	r := &rule{text: line}
+	switch {
+	case strings.HasPrefix(line, "!"):
+		r.negate = true
+		line = line[1:]
+	case strings.HasPrefix(line, `\!`), strings.HasPrefix(line, `\#`):
+		line = line[1:]
+	}
+	if strings.HasSuffix(line, "/") {
+		r.dirOnly = true
+		line = strings.TrimSuffix(line, "/")
+	}
+	if line == "" {
+		return nil, nil
+	}
+	anchored := strings.Contains(line, "/")
+	line = strings.TrimPrefix(line, "/")
+
+	expr, err := globToRegexp(line)
+	if err != nil {
+		return nil, fmt.Errorf("bad pattern %q: %w", r.text, err)
+	}
+	if anchored {
+		expr = "^" + expr + "$"
+	} else {
+		expr = "(?:^|/)" + expr + "$"
+	}
+	if r.re, err = regexp.Compile(expr); err != nil {
+		return nil, fmt.Errorf("bad pattern %q: %w", r.text, err)
+	}
+	return r, nil
+}
+
+// parsePattern parses an --include or --exclude pattern, either a gitignore style glob
+// or a regular expression prefixed with "re:".
+func parsePattern(pattern string) (*rule, error) {
+	if expr, ok := strings.CutPrefix(pattern, regexPrefix); ok {
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, fmt.Errorf("bad regular expression %q: %w", expr, err)
+		}
+		return &rule{text: pattern, re: re}, nil
+	}
+	r, err := parseRule(pattern)
+	if err == nil && r == nil {
+		err = fmt.Errorf("empty pattern %q", pattern)
+	}
+	if err == nil && r.negate {
+		err = fmt.Errorf("negated pattern %q only makes sense in a .keeprignore file", pattern)
+	}
+	return r, err
+}
+
+// Glob is a compiled gitignore style pattern for matching against arbitrary paths.
+type Glob struct {
+	r *rule
+}
+
+// CompileGlob compiles pattern with the same rules as a .keeprignore line, without negation:
+// a pattern without a slash matches the last elements of a path, one with a slash the whole path.
+func CompileGlob(pattern string) (*Glob, error) {
+	r, err := parsePattern(pattern)
+	if err != nil {
+		return nil, err
+	}
+	return &Glob{r: r}, nil
+}
+
+// Match reports whether the slash separated path matches, a leading slash is ignored.
+func (g *Glob) Match(path string) bool {
+	return g.r.match(strings.TrimPrefix(path, "/"), g.r.dirOnly)
+}
+
+func (r *rule) match(rel string, isDir bool) bool {
+	if r.dirOnly && !isDir {
+		return false
+	}
+	return r.re.MatchString(rel)
+}
+
+// globToRegexp translates a gitignore glob into an unanchored regular expression.
+func globToRegexp(glob string) (string, error) {
+	var b strings.Builder
+	for i := 0; i < len(glob); i++ {
+		c := glob[i]
+		switch c {
+		case '*':
+			if i+1 < len(glob) && glob[i+1] == '*' {
+				atStart := i == 0 || glob[i-1] == '/'
+				atEnd := i+2 == len(glob) || glob[i+2] == '/'
+				if atStart && atEnd {
+					i++
+					if i+1 < len(glob) {
+						// "**/" matches zero or more directories
+						i++
+						b.WriteString("(?:.*/)?")
+					} else {
+						b.WriteString(".*")
+					}
+					continue
+				}
+			}
+			b.WriteString("[^/]*")
+		case '?':
+			b.WriteString("[^/]")
+		case '[':
+			end := strings.IndexByte(glob[i+1:], ']')
+			if end < 0 {
+				return "", fmt.Errorf("unterminated character class")
+			}
+			class := glob[i+1 : i+1+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			b.WriteString("[" + strings.ReplaceAll(class, `\`, `\\`) + "]")
+			i += end + 1
+		case '\\':
+			if i+1 < len(glob) {
+				i++
+				b.WriteString(regexp.QuoteMeta(string(glob[i])))
+			}
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	return b.String(), nil
+}
@@ -0,0 +1,158 @@
+//go:build linux || darwin || freebsd
+
+package mount
+
+import (
+	"context"
+	"hash/fnv"
+	"path"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/hanwen/go-fuse/v2/fs"
+	"github.com/hanwen/go-fuse/v2/fuse"
+)
+
+// cacheTimeout is how long the kernel may cache names and attributes, and so how long an Update takes to show.
+const cacheTimeout = time.Second
+
+// Mount is a mounted Tree.
+type Mount struct {
+	server *fuse.Server
+	tree   atomic.Pointer[Tree]
+}
+
+// New mounts tree read-only at dir, which must be an existing directory.
+func New(dir string, tree *Tree) (*Mount, error) {
+	m := &Mount{}
+	m.tree.Store(tree)
+	timeout := cacheTimeout
+	server, err := fs.Mount(dir, &node{m: m}, &fs.Options{
+		// mount(2) directly when we may, fusermount otherwise
+		MountOptions: fuse.MountOptions{FsName: "keepr", Name: "keepr", Options: []string{"ro"}, DirectMount: true},
+		EntryTimeout: &timeout,
+		AttrTimeout:  &timeout,
+	})
+	if err != nil {
+		return nil, err
+	}
+	m.server = server
+	return m, nil
+}
+
+// Update replaces the tree, open files keep reading from where they were opened.
+func (m *Mount) Update(tree *Tree) {
+	m.tree.Store(tree)
+}
+
+// Wait returns once the filesystem is unmounted.
+func (m *Mount) Wait() {
+	m.server.Wait()
+}
+
+// Unmount unmounts the filesystem, which fails while anything in it is busy.
+func (m *Mount) Unmount() error {
+	return m.server.Unmount()
+}
+
+// node is a directory or file of the tree at path, whichever tree is current when it is asked.
+type node struct {
+	fs.Inode
+	m    *Mount
+	path string
+}
+
+var (
+	_ fs.NodeLookuper  = (*node)(nil)
+	_ fs.NodeReaddirer = (*node)(nil)
+	_ fs.NodeGetattrer = (*node)(nil)
+	_ fs.NodeOpener    = (*node)(nil)
+)
+
+// ino gives every path its own inode number, a file in several views is a file per view.
+func ino(p string, dir bool) uint64 {
+	h := fnv.New64a()
+	if dir {
+		_, _ = h.Write([]byte("d"))
+	}
+	_, _ = h.Write([]byte(p))
+	return h.Sum64() | 2 // 1 is the root
+}
+
+func (n *node) Readdir(ctx context.Context) (fs.DirStream, syscall.Errno) {
+	entries, ok := n.m.tree.Load().Dir(n.path)
+	if !ok {
+		return nil, syscall.ENOENT
+	}
+	list := make([]fuse.DirEntry, 0, len(entries))
+	for _, e := range entries {
+		mode := uint32(fuse.S_IFREG)
+		if e.Dir {
+			mode = fuse.S_IFDIR
+		}
+		list = append(list, fuse.DirEntry{Name: e.Name, Mode: mode, Ino: ino(path.Join(n.path, e.Name), e.Dir)})
+	}
+	return fs.NewListDirStream(list), 0
+}
+
+func (n *node) Lookup(ctx context.Context, name string, out *fuse.EntryOut) (*fs.Inode, syscall.Errno) {
+	tree := n.m.tree.Load()
+	p := path.Join(n.path, name)
+	child := &node{m: n.m, path: p}
+	if _, ok := tree.Dir(p); ok {
+		dirAttr(tree, &out.Attr)
+		return n.NewInode(ctx, child, fs.StableAttr{Mode: fuse.S_IFDIR, Ino: ino(p, true)}), 0
+	}
+	real, ok := tree.File(p)
+	if !ok {
+		return nil, syscall.ENOENT
+	}
+	if errno := fileAttr(real, &out.Attr); errno != 0 {
+		return nil, errno
+	}
+	return n.NewInode(ctx, child, fs.StableAttr{Mode: fuse.S_IFREG, Ino: ino(p, false)}), 0
+}
+
+func (n *node) Getattr(ctx context.Context, f fs.FileHandle, out *fuse.AttrOut) syscall.Errno {
+	tree := n.m.tree.Load()
+	if _, ok := tree.Dir(n.path); ok || n.path == "" {
+		dirAttr(tree, &out.Attr)
+		return 0
+	}
+	if real, ok := tree.File(n.path); ok {
+		return fileAttr(real, &out.Attr)
+	}
+	return syscall.ENOENT
+}
+
+func (n *node) Open(ctx context.Context, flags uint32) (fs.FileHandle, uint32, syscall.Errno) {
+	if flags&uint32(syscall.O_WRONLY|syscall.O_RDWR|syscall.O_TRUNC|syscall.O_APPEND) != 0 {
+		return nil, 0, syscall.EROFS
+	}
+	real, ok := n.m.tree.Load().File(n.path)
+	if !ok {
+		return nil, 0, syscall.ENOENT
+	}
+	fd, err := syscall.Open(real, syscall.O_RDONLY, 0)
+	if err != nil {
+		return nil, 0, fs.ToErrno(err)
+	}
+	return fs.NewLoopbackFile(fd), fuse.FOPEN_KEEP_CACHE, 0
+}
+
+func dirAttr(tree *Tree, attr *fuse.Attr) {
+	attr.Mode = fuse.S_IFDIR | 0o555
+	attr.SetTimes(nil, &tree.Built, &tree.Built)
+}
+
+// fileAttr reports the original file's attributes, minus write permission.
+func fileAttr(real string, attr *fuse.Attr) syscall.Errno {
+	var st syscall.Stat_t
+	if err := syscall.Stat(real, &st); err != nil {
+		return fs.ToErrno(err)
+	}
+	attr.FromStat(&st)
+	attr.Mode &^= 0o222
+	return 0
+}
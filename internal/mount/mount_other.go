@@ -0,0 +1,19 @@
+//go:build !linux && !darwin && !freebsd
+
+package mount
+
+import "errors"
+
+// Mount is only implemented where FUSE is.
+type Mount struct{}
+
+// New always fails on this platform.
+func New(dir string, tree *Tree) (*Mount, error) {
+	return nil, errors.New("mounting needs FUSE, which this platform lacks")
+}
+
+func (m *Mount) Update(tree *Tree) {}
+
+func (m *Mount) Wait() {}
+
+func (m *Mount) Unmount() error { return nil }
@@ -0,0 +1,85 @@
+// Package mount presents the library as a read-only FUSE filesystem: every view is a directory
+// holding the samples in it, which read straight from the original files. Nothing is written to disk,
+// so a new layout is a new Tree rather than a rebuilt symlink farm.
+package mount
+
+import (
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"git.tcp.direct/kayos/keepr/internal/collect"
+)
+
+// Entry is a directory entry of a Tree.
+type Entry struct {
+	Name string
+	Dir  bool
+}
+
+// Tree is the directory layout of a mount. Paths are slash separated and relative, "" is the root.
+type Tree struct {
+	dirs  map[string][]Entry
+	files map[string]string
+	// Built is when the tree was built, directories report it as their modification time.
+	Built time.Time
+}
+
+// NewTree lays out views, as returned by collect.Collection.Views, as directories. Samples sharing
+// a name in a view are told apart by a number, e.g. "kick (2).wav", in the order of their paths.
+func NewTree(views map[string][]*collect.Sample) *Tree {
+	t := &Tree{dirs: map[string][]Entry{"": nil}, files: make(map[string]string), Built: time.Now()}
+	for view, samples := range views {
+		t.mkdirAll(view)
+		sorted := append([]*collect.Sample(nil), samples...)
+		sort.Slice(sorted, func(i, j int) bool { return sorted[i].Path < sorted[j].Path })
+		for _, s := range sorted {
+			name := s.Name
+			for n := 2; t.exists(path.Join(view, name)); n++ {
+				ext := filepath.Ext(s.Name)
+				name = strings.TrimSuffix(s.Name, ext) + " (" + strconv.Itoa(n) + ")" + ext
+			}
+			t.files[path.Join(view, name)] = s.Path
+			t.dirs[view] = append(t.dirs[view], Entry{Name: name})
+		}
+	}
+	for _, entries := range t.dirs {
+		sort.Slice(entries, func(i, j int) bool { return entries[i].Name < entries[j].Name })
+	}
+	return t
+}
+
+func (t *Tree) exists(p string) bool {
+	_, dir := t.dirs[p]
+	_, file := t.files[p]
+	return dir || file
+}
+
+// mkdirAll adds dir and every parent it lacks.
+func (t *Tree) mkdirAll(dir string) {
+	if _, ok := t.dirs[dir]; ok || dir == "." {
+		return
+	}
+	parent := path.Dir(dir)
+	if parent == "." {
+		parent = ""
+	}
+	t.mkdirAll(parent)
+	t.dirs[dir] = []Entry{}
+	t.dirs[parent] = append(t.dirs[parent], Entry{Name: path.Base(dir), Dir: true})
+}
+
+// Dir returns the entries of the directory at p, sorted by name.
+func (t *Tree) Dir(p string) ([]Entry, bool) {
+	entries, ok := t.dirs[p]
+	return entries, ok
+}
+
+// File returns the original file behind the file at p.
+func (t *Tree) File(p string) (string, bool) {
+	real, ok := t.files[p]
+	return real, ok
+}
@@ -0,0 +1,44 @@
+package mount
+
+import (
+	"testing"
+
+	"git.tcp.direct/kayos/keepr/internal/collect"
+)
+
+func TestNewTree(t *testing.T) {
+	a := &collect.Sample{Name: "kick.wav", Path: "/src/a/kick.wav"}
+	b := &collect.Sample{Name: "kick.wav", Path: "/src/b/kick.wav"}
+	pad := &collect.Sample{Name: "pad.wav", Path: "/src/pad.wav"}
+	tree := NewTree(map[string][]*collect.Sample{
+		"Drums/Kicks":          {b, a},
+		"Key/A_Minor":          {pad},
+		"Key/A_Minor/OneShots": {a},
+		"Queries/Dark Pads":    {pad},
+		"Sources/src":          {a, b, pad},
+	})
+
+	root, ok := tree.Dir("")
+	if !ok || len(root) != 4 || root[0] != (Entry{Name: "Drums", Dir: true}) || root[3].Name != "Sources" {
+		t.Errorf("root = %v", root)
+	}
+	minor, _ := tree.Dir("Key/A_Minor")
+	if len(minor) != 2 || minor[0] != (Entry{Name: "OneShots", Dir: true}) || minor[1] != (Entry{Name: "pad.wav"}) {
+		t.Errorf("Key/A_Minor = %v", minor)
+	}
+	for p, want := range map[string]string{
+		"Drums/Kicks/kick.wav":      "/src/a/kick.wav",
+		"Drums/Kicks/kick (2).wav":  "/src/b/kick.wav",
+		"Queries/Dark Pads/pad.wav": "/src/pad.wav",
+	} {
+		if real, ok := tree.File(p); !ok || real != want {
+			t.Errorf("%s = %q, want %q", p, real, want)
+		}
+	}
+	if _, ok := tree.File("Drums/Kicks"); ok {
+		t.Error("directory found as a file")
+	}
+	if _, ok := tree.Dir("Drums/Snares"); ok {
+		t.Error("found a view that doesn't exist")
+	}
+}
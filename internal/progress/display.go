@@ -0,0 +1,153 @@
+package progress
+
+import (
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// redraw is how often the status line is redrawn on a terminal.
+const redraw = 200 * time.Millisecond
+
+// display shows the phases of a run as they go.
+type display struct {
+	mu sync.Mutex
+	// term is where the status line goes, nil when it isn't a terminal and logf is used instead.
+	term *os.File
+	// line is the status line on term, if any.
+	line string
+	logf func(Stats)
+	// every is how often logf gets the current phase, logged when it last did.
+	every  time.Duration
+	logged time.Time
+	// finished is how many of phases have been shown as ended.
+	finished int
+}
+
+var (
+	activeMu sync.Mutex
+	active   *display
+)
+
+// Show shows the progress of every phase until the returned function is called. When w is a
+// terminal it keeps a status line on it up to date, and leaves a line with the totals of every phase
+// that ends. Otherwise it passes the stats of the current phase to logf every interval, and those of
+// every phase that ended.
+func Show(w *os.File, interval time.Duration, logf func(Stats)) (stop func()) {
+	d := &display{logf: logf, every: interval, logged: time.Now()}
+	tick := min(interval, time.Second)
+	if fi, err := w.Stat(); err == nil && fi.Mode()&os.ModeCharDevice != 0 {
+		d.term, tick = w, redraw
+	}
+	activeMu.Lock()
+	active = d
+	phasesMu.Lock()
+	phases = nil
+	phasesMu.Unlock()
+	activeMu.Unlock()
+
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		// ended phases are shown within a tick, however long the interval
+		t := time.NewTicker(tick)
+		defer t.Stop()
+		for {
+			select {
+			case <-t.C:
+				d.update()
+			case <-done:
+				d.update()
+				d.mu.Lock()
+				d.clear()
+				d.mu.Unlock()
+				return
+			}
+		}
+	}()
+	return func() {
+		close(done)
+		<-stopped
+		activeMu.Lock()
+		active = nil
+		activeMu.Unlock()
+	}
+}
+
+func (d *display) update() {
+	phasesMu.Lock()
+	var ended []Stats
+	for _, p := range phases[d.finished:] {
+		s := p.Stats()
+		if !s.Done {
+			break
+		}
+		ended = append(ended, s)
+		d.finished++
+	}
+	phasesMu.Unlock()
+
+	p := Current()
+	if d.term == nil {
+		// logf logs through Wrap, which takes d.mu
+		for _, s := range ended {
+			d.logf(s)
+		}
+		if p != nil && time.Since(d.logged) >= d.every {
+			d.logf(p.Stats())
+			d.logged = time.Now()
+		}
+		return
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for _, s := range ended {
+		d.clear()
+		_, _ = io.WriteString(d.term, s.String()+"\n")
+	}
+	if p == nil {
+		d.clear()
+		return
+	}
+	d.line = p.Stats().String()
+	_, _ = io.WriteString(d.term, "\r\x1b[K"+d.line)
+}
+
+// clear removes the status line. d.mu must be held.
+func (d *display) clear() {
+	if d.term != nil && d.line != "" {
+		_, _ = io.WriteString(d.term, "\r\x1b[K")
+		d.line = ""
+	}
+}
+
+// Wrap returns a writer that writes to w without mangling the status line shown on a terminal: the
+// line is cleared before every write and redrawn after it.
+func Wrap(w io.Writer) io.Writer {
+	return wrapped{w}
+}
+
+type wrapped struct {
+	w io.Writer
+}
+
+func (wr wrapped) Write(b []byte) (int, error) {
+	activeMu.Lock()
+	d := active
+	activeMu.Unlock()
+	if d == nil {
+		return wr.w.Write(b)
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	line := d.line
+	d.clear()
+	n, err := wr.w.Write(b)
+	if line != "" {
+		d.line = line
+		_, _ = io.WriteString(d.term, line)
+	}
+	return n, err
+}
@@ -0,0 +1,153 @@
+// Package progress counts what the phases of a run get done, and shows it while they run: as a
+// status line on a terminal, or as periodic log lines when nobody is watching one.
+package progress
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Phase is a part of a run, such as walking the source roots or analyzing what was found.
+type Phase struct {
+	Name       string
+	start      time.Time
+	total      int64
+	bytesTotal int64
+	files      atomic.Int64
+	bytes      atomic.Int64
+	end        atomic.Int64
+}
+
+var (
+	current atomic.Pointer[Phase]
+	// phases are the phases begun while a display is shown, for it to finish off the ones it missed
+	// the end of.
+	phasesMu sync.Mutex
+	phases   []*Phase
+)
+
+// Begin starts the phase called name, ending the current one. total and bytesTotal are how many
+// files and bytes it will go through, 0 if not known up front.
+func Begin(name string, total int, bytesTotal int64) *Phase {
+	p := &Phase{Name: name, start: time.Now(), total: int64(total), bytesTotal: bytesTotal}
+	if old := current.Swap(p); old != nil {
+		old.end.CompareAndSwap(0, time.Now().UnixNano())
+	}
+	activeMu.Lock()
+	if active != nil {
+		phasesMu.Lock()
+		phases = append(phases, p)
+		phasesMu.Unlock()
+	}
+	activeMu.Unlock()
+	return p
+}
+
+// End ends p, unless it has ended already.
+func (p *Phase) End() {
+	p.end.CompareAndSwap(0, time.Now().UnixNano())
+	current.CompareAndSwap(p, nil)
+}
+
+// Current returns the phase under way, nil if there is none.
+func Current() *Phase {
+	return current.Load()
+}
+
+// Add counts a file of n bytes as done in the current phase, if there is one.
+func Add(n int64) {
+	if p := current.Load(); p != nil {
+		p.files.Add(1)
+		p.bytes.Add(n)
+	}
+}
+
+// Stats are the counters of a phase at some point.
+type Stats struct {
+	Phase      string
+	Files      int64
+	Total      int64
+	Bytes      int64
+	BytesTotal int64
+	Elapsed    time.Duration
+	// Done is set once the phase has ended.
+	Done bool
+}
+
+// Stats returns p's counters as they are now.
+func (p *Phase) Stats() Stats {
+	s := Stats{
+		Phase: p.Name, Files: p.files.Load(), Total: p.total,
+		Bytes: p.bytes.Load(), BytesTotal: p.bytesTotal,
+	}
+	end := time.Now()
+	if ns := p.end.Load(); ns != 0 {
+		end, s.Done = time.Unix(0, ns), true
+	}
+	s.Elapsed = end.Sub(p.start)
+	return s
+}
+
+// FilesPerSec is the rate files got done at so far.
+func (s Stats) FilesPerSec() float64 {
+	if s.Elapsed <= 0 {
+		return 0
+	}
+	return float64(s.Files) / s.Elapsed.Seconds()
+}
+
+// MBPerSec is the rate files got read at so far, in megabytes.
+func (s Stats) MBPerSec() float64 {
+	if s.Elapsed <= 0 {
+		return 0
+	}
+	return float64(s.Bytes) / 1e6 / s.Elapsed.Seconds()
+}
+
+// Remaining is how many files are left, -1 if the total isn't known.
+func (s Stats) Remaining() int64 {
+	if s.Total <= 0 {
+		return -1
+	}
+	return max(s.Total-s.Files, 0)
+}
+
+// ETA estimates how long the rest of the phase takes at the rate so far, going by bytes when their
+// total is known since files differ a lot in size. It is 0 when there is nothing to go by.
+func (s Stats) ETA() time.Duration {
+	done, total := float64(s.Files), float64(s.Total)
+	if s.BytesTotal > 0 {
+		done, total = float64(s.Bytes), float64(s.BytesTotal)
+	}
+	if done <= 0 || total <= done {
+		return 0
+	}
+	return time.Duration(float64(s.Elapsed) * (total - done) / done).Round(time.Second)
+}
+
+func (s Stats) String() string {
+	if s.Done {
+		line := fmt.Sprintf("%s: %d files in %s, %.1f files/s", s.Phase, s.Files, s.Elapsed.Round(time.Millisecond), s.FilesPerSec())
+		if s.Bytes > 0 {
+			line += fmt.Sprintf(", %.1f MB/s", s.MBPerSec())
+		}
+		return line
+	}
+	line := fmt.Sprintf("%s: %d", s.Phase, s.Files)
+	if s.Total > 0 {
+		line += fmt.Sprintf("/%d", s.Total)
+	}
+	line += fmt.Sprintf(" files, %.1f files/s", s.FilesPerSec())
+	if s.Bytes > 0 {
+		line += fmt.Sprintf(", %.1f MB/s", s.MBPerSec())
+	}
+	if left := s.Remaining(); left >= 0 {
+		line += fmt.Sprintf(", %d left", left)
+	}
+	if eta := s.ETA(); eta > 0 {
+		line += ", ETA " + eta.String()
+	}
+	return line
+}
@@ -0,0 +1,56 @@
+package progress
+
+import (
+	"io"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStats(t *testing.T) {
+	s := Stats{Phase: "analysis", Files: 25, Total: 100, Bytes: 10e6, BytesTotal: 20e6, Elapsed: 10 * time.Second}
+	if s.FilesPerSec() != 2.5 || s.MBPerSec() != 1 || s.Remaining() != 75 {
+		t.Errorf("rates %v files/s %v MB/s, %d left", s.FilesPerSec(), s.MBPerSec(), s.Remaining())
+	}
+	// half the bytes are done, though only a quarter of the files
+	if eta := s.ETA(); eta != 10*time.Second {
+		t.Errorf("ETA %s, want 10s", eta)
+	}
+	if line := s.String(); !strings.Contains(line, "25/100 files") || !strings.Contains(line, "ETA 10s") {
+		t.Errorf("status line %q", line)
+	}
+	walking := Stats{Phase: "scan", Files: 3, Elapsed: time.Second}
+	if walking.Remaining() != -1 || walking.ETA() != 0 {
+		t.Error("a phase without a total has neither remaining files nor an ETA")
+	}
+}
+
+func TestShowLogs(t *testing.T) {
+	f, err := os.CreateTemp(t.TempDir(), "out")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var logged []Stats
+	out := Wrap(io.Discard)
+	stop := Show(f, time.Hour, func(s Stats) {
+		// logging goes through Wrap like the real logger's output does
+		_, _ = out.Write([]byte(s.String()))
+		logged = append(logged, s)
+	})
+
+	p := Begin("scan", 2, 0)
+	Add(10)
+	Add(20)
+	p.End()
+	Add(5) // no phase, not counted anywhere
+	stop()
+
+	if len(logged) != 1 || !logged[0].Done || logged[0].Files != 2 || logged[0].Bytes != 30 {
+		t.Errorf("logged %+v, want the ended phase once", logged)
+	}
+	if Current() != nil {
+		t.Error("phase still current after End")
+	}
+}
@@ -0,0 +1,297 @@
+package query
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-audio/wav"
+	"gopkg.in/music-theory.v0/key"
+
+	"git.tcp.direct/kayos/keepr/internal/collect"
+	"git.tcp.direct/kayos/keepr/internal/filter"
+)
+
+// comparison is a single field op value test.
+type comparison struct {
+	field, op, value string
+	match            func(*collect.Sample) bool
+}
+
+func (c *comparison) Match(s *collect.Sample) bool { return c.match(s) }
+
+func (c *comparison) String() string {
+	return c.field + c.op + strconv.Quote(c.value)
+}
+
+// metadataFields are text fields read from WAV metadata.
+var metadataFields = map[string]func(*wav.Metadata) string{
+	"artist":   func(m *wav.Metadata) string { return m.Artist },
+	"genre":    func(m *wav.Metadata) string { return m.Genre },
+	"title":    func(m *wav.Metadata) string { return m.Title },
+	"software": func(m *wav.Metadata) string { return m.Software },
+}
+
+// textFields are other text fields, ok is false when the sample doesn't have the field.
+var textFields = map[string]func(*collect.Sample) (string, bool){
+	// source is the label of the source root, as in the Sources view.
+	"source": func(s *collect.Sample) (string, bool) { return s.Root, s.Root != "" },
+	"progression": func(s *collect.Sample) (string, bool) {
+		if s.Progression == nil {
+			return "", false
+		}
+		return s.Progression.String(), true
+	},
+	"timesig": func(s *collect.Sample) (string, bool) {
+		if s.MIDI == nil {
+			return "", false
+		}
+		return s.MIDI.TimeSignature, true
+	},
+}
+
+// Fields lists every field a query can test, sorted.
+func Fields() []string {
+	names := []string{"key", "type", "kind", "drum", "instrument", "path", "name"}
+	for name := range collect.NumericFields {
+		names = append(names, name)
+	}
+	for name := range metadataFields {
+		names = append(names, name)
+	}
+	for name := range textFields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func newComparison(field, op, value string) (Expr, error) {
+	c := &comparison{field: field, op: op, value: value}
+	var err error
+	switch field {
+	case "key":
+		c.match, err = keyMatcher(op, value)
+	case "type":
+		c.match, err = enumMatcher(op, value, func(v string) (func(*collect.Sample) bool, bool) {
+			t, ok := collect.ParseSampleType(v)
+			return func(s *collect.Sample) bool { return s.IsType(t) }, ok
+		})
+	case "kind":
+		c.match, err = enumMatcher(op, value, func(v string) (func(*collect.Sample) bool, bool) {
+			k, ok := collect.ParseMIDIKind(v)
+			return func(s *collect.Sample) bool { return s.MIDI != nil && s.MIDI.Kind == k }, ok
+		})
+	case "drum":
+		c.match, err = enumMatcher(op, value, func(v string) (func(*collect.Sample) bool, bool) {
+			d, ok := collect.ParseDrumType(v)
+			return func(s *collect.Sample) bool {
+				return (s.IsType(collect.TypeDrum) || s.IsType(collect.TypeDrumLoop)) && s.DrumType == d
+			}, ok
+		})
+	case "instrument":
+		c.match, err = textMatcher(op, value, func(s *collect.Sample) []string {
+			if s.MIDI == nil {
+				return nil
+			}
+			return s.MIDI.Instruments
+		})
+	case "path", "name":
+		c.match, err = globMatcher(field, op, value)
+	default:
+		if get, ok := collect.NumericFields[field]; ok {
+			c.match, err = numericMatcher(field, op, value, get)
+			break
+		}
+		if get, ok := metadataFields[field]; ok {
+			c.match, err = textMatcher(op, value, func(s *collect.Sample) []string {
+				if s.Metadata == nil || get(s.Metadata) == "" {
+					return nil
+				}
+				return []string{get(s.Metadata)}
+			})
+			break
+		}
+		if get, ok := textFields[field]; ok {
+			c.match, err = textMatcher(op, value, func(s *collect.Sample) []string {
+				if v, ok := get(s); ok {
+					return []string{v}
+				}
+				return nil
+			})
+			break
+		}
+		return nil, fmt.Errorf("unknown field %q, want one of %s", field, strings.Join(Fields(), ", "))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s%s%s: %w", field, op, value, err)
+	}
+	return c, nil
+}
+
+func opError(op string, allowed ...string) error {
+	return fmt.Errorf("operator %s not supported here, use %s", op, strings.Join(allowed, " "))
+}
+
+// negate wraps match for the != operator.
+func negate(op string, match func(*collect.Sample) bool) func(*collect.Sample) bool {
+	if op != "!=" {
+		return match
+	}
+	return func(s *collect.Sample) bool { return !match(s) }
+}
+
+func enumMatcher(op, value string, parse func(string) (func(*collect.Sample) bool, bool)) (func(*collect.Sample) bool, error) {
+	if op != "=" && op != "!=" {
+		return nil, opError(op, "=", "!=")
+	}
+	match, ok := parse(value)
+	if !ok {
+		return nil, fmt.Errorf("unknown value %q", value)
+	}
+	return negate(op, match), nil
+}
+
+// textMatcher compares case insensitively, ~ tests for a substring. Samples with several values match if any does.
+func textMatcher(op, value string, get func(*collect.Sample) []string) (func(*collect.Sample) bool, error) {
+	var test func(string) bool
+	switch op {
+	case "=", "!=":
+		test = func(v string) bool { return strings.EqualFold(v, value) }
+	case "~":
+		lower := strings.ToLower(value)
+		test = func(v string) bool { return strings.Contains(strings.ToLower(v), lower) }
+	default:
+		return nil, opError(op, "=", "!=", "~")
+	}
+	return negate(op, func(s *collect.Sample) bool {
+		for _, v := range get(s) {
+			if test(v) {
+				return true
+			}
+		}
+		return false
+	}), nil
+}
+
+// globMatcher matches paths and file names against a .keeprignore style glob.
+func globMatcher(field, op, value string) (func(*collect.Sample) bool, error) {
+	if op != "=" && op != "~" && op != "!=" {
+		return nil, opError(op, "=", "!=", "~")
+	}
+	g, err := filter.CompileGlob(value)
+	if err != nil {
+		return nil, err
+	}
+	return negate(op, func(s *collect.Sample) bool {
+		if field == "name" {
+			return g.Match(s.Name)
+		}
+		return g.Match(strings.ReplaceAll(s.Path, `\`, "/"))
+	}), nil
+}
+
+// numericMatcher compares numbers, = and != also take a LO..HI range with either end left open.
+func numericMatcher(field, op, value string, get func(*collect.Sample) (float64, bool)) (func(*collect.Sample) bool, error) {
+	parse := func(v string) (float64, error) {
+		if field == "duration" {
+			if d, err := time.ParseDuration(v); err == nil {
+				return d.Seconds(), nil
+			}
+		}
+		return strconv.ParseFloat(v, 64)
+	}
+	if lo, hi, ok := strings.Cut(value, ".."); ok {
+		if op != "=" && op != "!=" {
+			return nil, opError(op, "=", "!=")
+		}
+		min, max := -1e18, 1e18
+		var err error
+		if lo != "" {
+			if min, err = parse(lo); err != nil {
+				return nil, err
+			}
+		}
+		if hi != "" {
+			if max, err = parse(hi); err != nil {
+				return nil, err
+			}
+		}
+		return negate(op, func(s *collect.Sample) bool {
+			v, ok := get(s)
+			return ok && v >= min && v <= max
+		}), nil
+	}
+	want, err := parse(value)
+	if err != nil {
+		return nil, err
+	}
+	var test func(v float64) bool
+	switch op {
+	case "=", "!=":
+		test = func(v float64) bool { return v == want }
+	case "<":
+		test = func(v float64) bool { return v < want }
+	case "<=":
+		test = func(v float64) bool { return v <= want }
+	case ">":
+		test = func(v float64) bool { return v > want }
+	case ">=":
+		test = func(v float64) bool { return v >= want }
+	default:
+		return nil, opError(op, "=", "!=", "<", "<=", ">", ">=")
+	}
+	return negate(op, func(s *collect.Sample) bool {
+		v, ok := get(s)
+		return ok && test(v)
+	}), nil
+}
+
+// keyMatcher compares keys, ~ matches keys that mix well with the given one.
+func keyMatcher(op, value string) (func(*collect.Sample) bool, error) {
+	want, err := ParseKey(value)
+	if err != nil {
+		return nil, err
+	}
+	var test func(key.Key) bool
+	switch op {
+	case "=", "!=":
+		test = func(k key.Key) bool { return k.Root == want.Root && k.Mode == want.Mode }
+	case "~":
+		test = func(k key.Key) bool { return Compatible(k, want) }
+	default:
+		return nil, opError(op, "=", "!=", "~")
+	}
+	return negate(op, func(s *collect.Sample) bool { return s.Key.Root != 0 && test(s.Key) }), nil
+}
+
+// ParseKey parses a key name such as "A minor", "Am" or "f# min".
+func ParseKey(name string) (key.Key, error) {
+	name = strings.TrimSpace(name)
+	if name != "" {
+		name = strings.ToUpper(name[:1]) + name[1:]
+	}
+	k := key.Of(name)
+	if k.Root == 0 {
+		return k, fmt.Errorf("unknown key %q", name)
+	}
+	return k, nil
+}
+
+// Compatible reports whether two keys mix harmonically: the same key, its relative major or minor,
+// or a fifth up or down in the same mode, the neighbours on the circle of fifths.
+func Compatible(a, b key.Key) bool {
+	pa, pb := int(a.Root)-1, int(b.Root)-1
+	diff := (pb - pa + 12) % 12
+	switch {
+	case a.Mode == b.Mode:
+		return diff == 0 || diff == 5 || diff == 7
+	case a.Mode == key.Major:
+		// relative minor is three semitones down
+		return diff == 9
+	default:
+		return diff == 3
+	}
+}
@@ -0,0 +1,315 @@
+// Package query implements the filter expressions of keepr query.
+//
+// An expression compares sample fields to values, e.g.
+//
+//	type=loop and key~"A minor" and tempo=138..142 and bars>4
+//
+// Comparisons are joined with and, or and not (or &&, || and !), grouped with parentheses,
+// and comparisons written next to each other are and'ed.
+package query
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"git.tcp.direct/kayos/keepr/internal/collect"
+)
+
+// Expr is a parsed query expression.
+type Expr interface {
+	Match(s *collect.Sample) bool
+	String() string
+}
+
+type (
+	and []Expr
+	or  []Expr
+	not struct{ Expr }
+)
+
+func (e and) Match(s *collect.Sample) bool {
+	for _, sub := range e {
+		if !sub.Match(s) {
+			return false
+		}
+	}
+	return true
+}
+
+func (e or) Match(s *collect.Sample) bool {
+	for _, sub := range e {
+		if sub.Match(s) {
+			return true
+		}
+	}
+	return false
+}
+
+func (e not) Match(s *collect.Sample) bool { return !e.Expr.Match(s) }
+
+func (e and) String() string { return join(e, " and ") }
+func (e or) String() string  { return "(" + join(e, " or ") + ")" }
+func (e not) String() string { return "not " + e.Expr.String() }
+
+func join(exprs []Expr, sep string) string {
+	var parts []string
+	for _, e := range exprs {
+		parts = append(parts, e.String())
+	}
+	return strings.Join(parts, sep)
+}
+
+// All matches every sample, it's what an empty query parses to.
+var All Expr = and{}
+
+// Parse parses an expression.
+func Parse(expr string) (Expr, error) {
+	toks, err := lex(expr)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{toks: toks}
+	if len(toks) == 0 {
+		return All, nil
+	}
+	e, err := p.or()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.toks) {
+		return nil, fmt.Errorf("unexpected %s", p.toks[p.pos])
+	}
+	return e, nil
+}
+
+// And combines expressions so that all of them have to match.
+func And(exprs ...Expr) Expr {
+	return and(exprs)
+}
+
+type tokenKind int
+
+const (
+	tokWord tokenKind = iota
+	tokString
+	tokOp
+	tokLParen
+	tokRParen
+	tokAnd
+	tokOr
+	tokNot
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	pos  int
+}
+
+func (t token) String() string {
+	if t.kind == tokString {
+		return strconv.Quote(t.text)
+	}
+	return fmt.Sprintf("%q at %d", t.text, t.pos+1)
+}
+
+// ops are the comparison operators, longest first.
+var ops = []string{"!=", "<=", ">=", "=", "<", ">", "~"}
+
+// wordBreaks end a bare word.
+const wordBreaks = `()"=!<>~&|`
+
+func lex(s string) ([]token, error) {
+	var toks []token
+	for i := 0; i < len(s); {
+		c := rune(s[i])
+		switch {
+		case unicode.IsSpace(c):
+			i++
+		case c == '(':
+			toks = append(toks, token{tokLParen, "(", i})
+			i++
+		case c == ')':
+			toks = append(toks, token{tokRParen, ")", i})
+			i++
+		case strings.HasPrefix(s[i:], "&&"):
+			toks = append(toks, token{tokAnd, "&&", i})
+			i += 2
+		case strings.HasPrefix(s[i:], "||"):
+			toks = append(toks, token{tokOr, "||", i})
+			i += 2
+		case c == '"':
+			end := i + 1
+			for ; end < len(s) && s[end] != '"'; end++ {
+				if s[end] == '\\' {
+					end++
+				}
+			}
+			if end >= len(s) {
+				return nil, fmt.Errorf("unterminated string at %d", i+1)
+			}
+			text, err := strconv.Unquote(s[i : end+1])
+			if err != nil {
+				return nil, fmt.Errorf("bad string at %d: %w", i+1, err)
+			}
+			toks = append(toks, token{tokString, text, i})
+			i = end + 1
+		default:
+			if op := opAt(s[i:]); op != "" {
+				toks = append(toks, token{tokOp, op, i})
+				i += len(op)
+				continue
+			}
+			if c == '!' {
+				toks = append(toks, token{tokNot, "!", i})
+				i++
+				continue
+			}
+			end := i
+			for end < len(s) && !unicode.IsSpace(rune(s[end])) && !strings.ContainsRune(wordBreaks, rune(s[end])) {
+				end++
+			}
+			if end == i {
+				return nil, fmt.Errorf("unexpected %q at %d", c, i+1)
+			}
+			word := s[i:end]
+			kind := tokWord
+			switch strings.ToLower(word) {
+			case "and":
+				kind = tokAnd
+			case "or":
+				kind = tokOr
+			case "not":
+				kind = tokNot
+			}
+			toks = append(toks, token{kind, word, i})
+			i = end
+		}
+	}
+	return toks, nil
+}
+
+func opAt(s string) string {
+	for _, op := range ops {
+		if strings.HasPrefix(s, op) {
+			return op
+		}
+	}
+	return ""
+}
+
+type parser struct {
+	toks []token
+	pos  int
+}
+
+func (p *parser) peek() (token, bool) {
+	if p.pos >= len(p.toks) {
+		return token{}, false
+	}
+	return p.toks[p.pos], true
+}
+
+func (p *parser) or() (Expr, error) {
+	var terms or
+	for {
+		e, err := p.and()
+		if err != nil {
+			return nil, err
+		}
+		terms = append(terms, e)
+		if t, ok := p.peek(); !ok || t.kind != tokOr {
+			break
+		}
+		p.pos++
+	}
+	if len(terms) == 1 {
+		return terms[0], nil
+	}
+	return terms, nil
+}
+
+func (p *parser) and() (Expr, error) {
+	var terms and
+	for {
+		e, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		terms = append(terms, e)
+		t, ok := p.peek()
+		if !ok || t.kind == tokOr || t.kind == tokRParen {
+			break
+		}
+		if t.kind == tokAnd {
+			p.pos++
+		}
+		// anything else is another term written next to this one
+	}
+	if len(terms) == 1 {
+		return terms[0], nil
+	}
+	return terms, nil
+}
+
+func (p *parser) unary() (Expr, error) {
+	t, ok := p.peek()
+	if !ok {
+		return nil, fmt.Errorf("unexpected end of query")
+	}
+	switch t.kind {
+	case tokNot:
+		p.pos++
+		e, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		return not{e}, nil
+	case tokLParen:
+		p.pos++
+		e, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+		if closing, ok := p.peek(); !ok || closing.kind != tokRParen {
+			return nil, fmt.Errorf("missing ) for ( at %d", t.pos+1)
+		}
+		p.pos++
+		return e, nil
+	case tokWord:
+		return p.comparison()
+	}
+	return nil, fmt.Errorf("unexpected %s", t)
+}
+
+func (p *parser) comparison() (Expr, error) {
+	field := p.toks[p.pos]
+	p.pos++
+	op, ok := p.peek()
+	if !ok || op.kind != tokOp {
+		return nil, fmt.Errorf("expected an operator after %s", field)
+	}
+	p.pos++
+	value, ok := p.peek()
+	if !ok || (value.kind != tokWord && value.kind != tokString) {
+		return nil, fmt.Errorf("expected a value after %s", op)
+	}
+	p.pos++
+	text := value.text
+	// key=A minor without quotes, as the shell leaves it
+	if next, ok := p.peek(); ok && next.kind == tokWord && strings.EqualFold(field.text, "key") && isMode(next.text) {
+		text += " " + next.text
+		p.pos++
+	}
+	return newComparison(strings.ToLower(field.text), op.text, text)
+}
+
+func isMode(word string) bool {
+	switch strings.ToLower(word) {
+	case "major", "minor", "maj", "min":
+		return true
+	}
+	return false
+}
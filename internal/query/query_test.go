@@ -0,0 +1,122 @@
+package query
+
+import (
+	"testing"
+	"time"
+
+	"github.com/go-audio/wav"
+	"gopkg.in/music-theory.v0/key"
+
+	"git.tcp.direct/kayos/keepr/internal/collect"
+)
+
+func testSamples() map[string]*collect.Sample {
+	return map[string]*collect.Sample{
+		"loop": {
+			Name: "synth_loop_140bpm_Am.wav", Path: "/samples/Loops/synth_loop_140bpm_Am.wav",
+			Key: key.Of("Am"), Tempo: 140, Duration: 7 * time.Second, Root: "Splice",
+			Types:    map[collect.SampleType]struct{}{collect.TypeLoop: {}, collect.TypeMelodic: {}},
+			Metadata: &wav.Metadata{Artist: "Some Artist", Genre: "Techno"},
+		},
+		"kick": {
+			Name: "kick_01.wav", Path: "/samples/Drums/kick_01.wav", Duration: time.Second / 2,
+			Types: map[collect.SampleType]struct{}{collect.TypeDrum: {}, collect.TypeOneShot: {}},
+		},
+		"midi": {
+			Name: "chords_C.mid", Path: "/samples/MIDI/chords_C.mid",
+			Key: key.Of("C"), Tempo: 120, Duration: 8 * time.Second,
+			Types: map[collect.SampleType]struct{}{collect.TypeMIDI: {}},
+			MIDI:  &collect.MIDIInfo{Kind: collect.MIDIChords, TimeSignature: "4/4", Bars: 4},
+		},
+	}
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		expr string
+		want []string
+	}{
+		{"", []string{"kick", "loop", "midi"}},
+		{"type=loop", []string{"loop"}},
+		{"TYPE = Loop", []string{"loop"}},
+		{"type!=loop", []string{"kick", "midi"}},
+		{`key="A minor"`, []string{"loop"}},
+		{"key=A minor", []string{"loop"}},
+		{"key=am", []string{"loop"}},
+		{"key~C", []string{"loop", "midi"}},
+		{"key~G", []string{"midi"}},
+		{"tempo=130..150", []string{"loop"}},
+		{"tempo=..130", []string{"midi"}},
+		{"tempo>=120 tempo<140", []string{"midi"}},
+		{"duration<=1s", []string{"kick"}},
+		{"duration=5..", []string{"loop", "midi"}},
+		{"type=midi or type=drum", []string{"kick", "midi"}},
+		{"type=midi || type=drum && tempo>0", []string{"midi"}},
+		{"(type=midi or type=drum) and tempo>0", []string{"midi"}},
+		{"not type=midi", []string{"kick", "loop"}},
+		{"!(type=midi or type=loop)", []string{"kick"}},
+		{"artist~artist genre=techno", []string{"loop"}},
+		{"source=splice", []string{"loop"}},
+		{"kind=chords timesig=4/4 bars=4", []string{"midi"}},
+		{"path=/samples/Drums/*", []string{"kick"}},
+		{"name~*.mid", []string{"midi"}},
+		{"path=**/Loops/**", []string{"loop"}},
+	}
+	samples := testSamples()
+	for _, tt := range tests {
+		expr, err := Parse(tt.expr)
+		if err != nil {
+			t.Errorf("Parse(%q): %v", tt.expr, err)
+			continue
+		}
+		var got []string
+		for _, name := range []string{"kick", "loop", "midi"} {
+			if expr.Match(samples[name]) {
+				got = append(got, name)
+			}
+		}
+		if len(got) != len(tt.want) {
+			t.Errorf("%q (%s) matched %v, want %v", tt.expr, expr, got, tt.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != tt.want[i] {
+				t.Errorf("%q (%s) matched %v, want %v", tt.expr, expr, got, tt.want)
+				break
+			}
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, bad := range []string{
+		"type", "type=", "=loop", "bogus=1", "type=bogus", "key=H", "tempo~140",
+		"tempo=fast", "(type=loop", "type=loop)", `name="unterminated`, "type=loop or", "key<C",
+	} {
+		if _, err := Parse(bad); err == nil {
+			t.Errorf("Parse(%q) should fail", bad)
+		}
+	}
+}
+
+func TestCompatible(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want bool
+	}{
+		{"C", "C", true},
+		{"C", "G", true},
+		{"C", "F", true},
+		{"C", "Am", true},
+		{"Am", "C", true},
+		{"Am", "Em", true},
+		{"C", "D", false},
+		{"C", "Cm", false},
+		{"C", "Em", false},
+	}
+	for _, tt := range tests {
+		if got := Compatible(key.Of(tt.a), key.Of(tt.b)); got != tt.want {
+			t.Errorf("Compatible(%s, %s) = %v, want %v", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
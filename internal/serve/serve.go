@@ -0,0 +1,257 @@
+// Package serve is keepr's local web UI and JSON API for browsing, searching and previewing the collection.
+//
+//	GET /                        the web UI
+//	GET /api/samples             search: q is a query expression, key, tempo, type, drum and source
+//	                             are facets (repeat one to match any of its values), sort, limit and
+//	                             offset page through the results; facet counts cover every result
+//	GET /api/samples/ID          a single sample with its analysis details
+//	GET /api/samples/ID/audio    the original file, range requests supported
+//	GET /api/samples/ID/peaks    the waveform as audiowaveform JSON, rendered on first request
+//	GET /api/samples/ID/waveform.png, /api/samples/ID/spectrogram.png    thumbnails, likewise
+package serve
+
+import (
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/rs/zerolog"
+
+	"git.tcp.direct/kayos/keepr/internal/collect"
+	"git.tcp.direct/kayos/keepr/internal/config"
+	"git.tcp.direct/kayos/keepr/internal/query"
+)
+
+var log *zerolog.Logger
+
+func init() {
+	log = config.GetLogger()
+}
+
+//go:embed index.html
+var indexHTML []byte
+
+// facets are the search parameters results are counted by, in the order the UI shows them.
+var facets = []string{"type", "key", "tempo", "drum", "source"}
+
+// defaultLimit is how many results a search returns unless asked for more or fewer.
+const defaultLimit = 100
+
+// Item is a sample as the API returns it.
+type Item struct {
+	ID string `json:"id"`
+	collect.Record
+}
+
+// Results is what a search returns, Facets counts the values of each facet across all Total results.
+type Results struct {
+	Total   int                       `json:"total"`
+	Offset  int                       `json:"offset"`
+	Samples []*Item                   `json:"samples"`
+	Facets  map[string]map[string]int `json:"facets"`
+}
+
+// Server serves a collection, which must not change while it does.
+type Server struct {
+	lib   *collect.Collection
+	ids   map[string]*collect.Sample
+	items map[*collect.Sample]*Item
+}
+
+// New prepares a Server for lib.
+func New(lib *collect.Collection) *Server {
+	srv := &Server{
+		lib:   lib,
+		ids:   make(map[string]*collect.Sample),
+		items: make(map[*collect.Sample]*Item),
+	}
+	categories := lib.Categories()
+	for _, s := range lib.Samples {
+		item := &Item{ID: s.ID(), Record: collect.NewRecord(s, categories[s])}
+		srv.ids[item.ID] = s
+		srv.items[s] = item
+	}
+	return srv
+}
+
+func (srv *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	log.Debug().Str("remote", r.RemoteAddr).Str("method", r.Method).Str("url", r.URL.String()).Msg("request")
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		httpError(w, http.StatusMethodNotAllowed, errors.New("read only"))
+		return
+	}
+	switch path := r.URL.Path; {
+	case path == "/" || path == "/index.html":
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		_, _ = w.Write(indexHTML)
+	case path == "/api/samples":
+		srv.search(w, r)
+	case strings.HasPrefix(path, "/api/samples/"):
+		id, rest, _ := strings.Cut(strings.TrimPrefix(path, "/api/samples/"), "/")
+		s, ok := srv.ids[id]
+		if !ok {
+			httpError(w, http.StatusNotFound, fmt.Errorf("no sample %q", id))
+			return
+		}
+		switch rest {
+		case "":
+			writeJSON(w, srv.items[s])
+		case "audio":
+			serveAudio(w, r, s)
+		case "peaks":
+			serveThumbnail(w, r, s, collect.ThumbPeaks)
+		case "waveform.png":
+			serveThumbnail(w, r, s, collect.ThumbWaveform)
+		case "spectrogram.png":
+			serveThumbnail(w, r, s, collect.ThumbSpectrogram)
+		default:
+			http.NotFound(w, r)
+		}
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// searchExpr builds the query from the q expression and the facet parameters.
+func searchExpr(params map[string][]string) (query.Expr, error) {
+	var exprs []query.Expr
+	for _, q := range params["q"] {
+		e, err := query.Parse(q)
+		if err != nil {
+			return nil, err
+		}
+		exprs = append(exprs, e)
+	}
+	for _, facet := range facets {
+		var any []string
+		for _, v := range params[facet] {
+			if v != "" {
+				any = append(any, facet+"="+strconv.Quote(v))
+			}
+		}
+		if len(any) == 0 {
+			continue
+		}
+		e, err := query.Parse(strings.Join(any, " or "))
+		if err != nil {
+			return nil, err
+		}
+		exprs = append(exprs, e)
+	}
+	return query.And(exprs...), nil
+}
+
+func (srv *Server) search(w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
+	expr, err := searchExpr(params)
+	if err != nil {
+		httpError(w, http.StatusBadRequest, err)
+		return
+	}
+	results := srv.lib.Filter(expr.Match)
+	if by := params.Get("sort"); by != "" {
+		if err = collect.SortSamples(results, by); err != nil {
+			httpError(w, http.StatusBadRequest, err)
+			return
+		}
+	} else {
+		sort.SliceStable(results, func(i, j int) bool { return results[i].Path < results[j].Path })
+	}
+	offset, limit := 0, defaultLimit
+	if v := params.Get("offset"); v != "" {
+		if offset, err = strconv.Atoi(v); err != nil || offset < 0 {
+			httpError(w, http.StatusBadRequest, errors.New("offset must be a positive number"))
+			return
+		}
+	}
+	if v := params.Get("limit"); v != "" {
+		if limit, err = strconv.Atoi(v); err != nil || limit < 0 {
+			httpError(w, http.StatusBadRequest, errors.New("limit must be a positive number"))
+			return
+		}
+	}
+
+	res := &Results{Total: len(results), Offset: offset, Samples: []*Item{}, Facets: make(map[string]map[string]int)}
+	for _, facet := range facets {
+		res.Facets[facet] = make(map[string]int)
+	}
+	for i, s := range results {
+		item := srv.items[s]
+		if i >= offset && len(res.Samples) < limit {
+			res.Samples = append(res.Samples, item)
+		}
+		count := func(facet, value string) {
+			if value != "" {
+				res.Facets[facet][value]++
+			}
+		}
+		for _, t := range item.Types {
+			count("type", t)
+		}
+		count("key", item.Key)
+		if item.Tempo > 0 {
+			count("tempo", strconv.Itoa(item.Tempo))
+		}
+		count("drum", item.Drum)
+		count("source", item.Source)
+	}
+	writeJSON(w, res)
+}
+
+// audioTypes are the content types of the files we catalog, browsers need them to play anything.
+var audioTypes = map[string]string{".wav": "audio/wav", ".mid": "audio/midi", ".midi": "audio/midi"}
+
+// serveAudio streams the original file, http.ServeContent takes care of range requests.
+func serveAudio(w http.ResponseWriter, r *http.Request, s *collect.Sample) {
+	f, err := os.Open(s.Path)
+	if err != nil {
+		httpError(w, http.StatusNotFound, errors.New("sample file is gone, re-run scan"))
+		return
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		httpError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if ct, ok := audioTypes[strings.ToLower(filepath.Ext(s.Path))]; ok {
+		w.Header().Set("Content-Type", ct)
+	}
+	http.ServeContent(w, r, s.Name, fi.ModTime(), f)
+}
+
+// serveThumbnail serves a cached thumbnail of s, rendering it first if it's missing or stale.
+func serveThumbnail(w http.ResponseWriter, r *http.Request, s *collect.Sample, kind string) {
+	if _, err := s.Thumbnails(); err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, collect.ErrNoAudio) || errors.Is(err, os.ErrNotExist) {
+			status = http.StatusNotFound
+		}
+		httpError(w, status, err)
+		return
+	}
+	if kind == collect.ThumbPeaks {
+		w.Header().Set("Content-Type", "application/json")
+	}
+	http.ServeFile(w, r, collect.ThumbnailPath(s, kind))
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Debug().Err(err).Msg("failed to write response")
+	}
+}
+
+func httpError(w http.ResponseWriter, status int, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+}
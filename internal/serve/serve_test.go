@@ -0,0 +1,134 @@
+package serve
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"gopkg.in/music-theory.v0/key"
+
+	"git.tcp.direct/kayos/keepr/internal/collect"
+)
+
+func testServer(t *testing.T) (*httptest.Server, *collect.Sample) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "synth_loop_120bpm_Am.wav")
+	if err := os.WriteFile(path, []byte("RIFF....WAVEfmt "), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	c := collect.NewCollection()
+	loop := &collect.Sample{
+		Name: "synth_loop_120bpm_Am.wav", Path: path, Root: "Splice", Key: key.Of("Am"), Tempo: 120,
+		Chroma: []float64{0.5, 0, 0.2, 0, 0.6, 0.3, 0, 0.4, 0, 1, 0, 0.1},
+		Types:  map[collect.SampleType]struct{}{collect.TypeMelodic: {}, collect.TypeLoop: {}},
+	}
+	kick := &collect.Sample{
+		Name: "kick_01.wav", Path: filepath.Join(dir, "kick_01.wav"), Root: "Cymatics", DrumType: collect.DrumKick,
+		Types: map[collect.SampleType]struct{}{collect.TypeDrum: {}, collect.TypeOneShot: {}},
+	}
+	c.IngestSample(loop)
+	c.IngestSample(kick)
+	srv := httptest.NewServer(New(c))
+	t.Cleanup(srv.Close)
+	return srv, loop
+}
+
+func get(t *testing.T, url string, header http.Header) (*http.Response, []byte) {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return res, body
+}
+
+func TestSearch(t *testing.T) {
+	srv, _ := testServer(t)
+	for _, tc := range []struct {
+		query string
+		want  []string
+	}{
+		{"", []string{"kick_01.wav", "synth_loop_120bpm_Am.wav"}},
+		{"?key=A+minor", []string{"synth_loop_120bpm_Am.wav"}},
+		{"?source=Splice&source=Cymatics&drum=kick", []string{"kick_01.wav"}},
+		{"?q=tempo%3E100", []string{"synth_loop_120bpm_Am.wav"}},
+		{"?type=loop&type=drum&limit=1&offset=1", []string{"synth_loop_120bpm_Am.wav"}},
+	} {
+		res, body := get(t, srv.URL+"/api/samples"+tc.query, nil)
+		if res.StatusCode != http.StatusOK {
+			t.Fatalf("%s: status %d: %s", tc.query, res.StatusCode, body)
+		}
+		var results Results
+		if err := json.Unmarshal(body, &results); err != nil {
+			t.Fatal(err)
+		}
+		var names []string
+		for _, s := range results.Samples {
+			names = append(names, s.Name)
+		}
+		if len(names) != len(tc.want) {
+			t.Errorf("%s: got %v, want %v", tc.query, names, tc.want)
+			continue
+		}
+		for i := range names {
+			if names[i] != tc.want[i] {
+				t.Errorf("%s: got %v, want %v", tc.query, names, tc.want)
+			}
+		}
+	}
+
+	_, body := get(t, srv.URL+"/api/samples", nil)
+	var results Results
+	if err := json.Unmarshal(body, &results); err != nil {
+		t.Fatal(err)
+	}
+	if results.Total != 2 || results.Facets["source"]["Splice"] != 1 || results.Facets["tempo"]["120"] != 1 || results.Facets["drum"]["kick"] != 1 {
+		t.Errorf("total %d, facets %v", results.Total, results.Facets)
+	}
+
+	if res, _ := get(t, srv.URL+"/api/samples?q=tempo%3E%3E", nil); res.StatusCode != http.StatusBadRequest {
+		t.Errorf("bad expression: status %d, want 400", res.StatusCode)
+	}
+}
+
+func TestSample(t *testing.T) {
+	srv, loop := testServer(t)
+	res, body := get(t, srv.URL+"/api/samples/"+loop.ID(), nil)
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("status %d: %s", res.StatusCode, body)
+	}
+	var item Item
+	if err := json.Unmarshal(body, &item); err != nil {
+		t.Fatal(err)
+	}
+	if item.ID != loop.ID() || item.Key != "A minor" || len(item.Chroma) != 12 {
+		t.Errorf("item = %+v", item)
+	}
+
+	res, body = get(t, srv.URL+"/api/samples/"+loop.ID()+"/audio", http.Header{"Range": {"bytes=4-7"}})
+	if res.StatusCode != http.StatusPartialContent || string(body) != "...." {
+		t.Errorf("range request: status %d, body %q", res.StatusCode, body)
+	}
+	if ct := res.Header.Get("Content-Type"); ct != "audio/wav" {
+		t.Errorf("content type %q", ct)
+	}
+
+	if res, _ = get(t, srv.URL+"/api/samples/deadbeef", nil); res.StatusCode != http.StatusNotFound {
+		t.Errorf("unknown id: status %d, want 404", res.StatusCode)
+	}
+}
@@ -0,0 +1,22 @@
+//go:build linux
+
+package util
+
+import (
+	"errors"
+
+	"golang.org/x/sys/unix"
+)
+
+// ErrNoExchange is returned by Exchange where paths can't be swapped atomically.
+var ErrNoExchange = errors.New("atomic exchange not supported")
+
+// Exchange swaps whatever is at a and b in a single step, so that anyone looking sees either the
+// one or the other, never neither. Both must exist and be on the same filesystem.
+func Exchange(a, b string) error {
+	err := unix.Renameat2(unix.AT_FDCWD, a, unix.AT_FDCWD, b, unix.RENAME_EXCHANGE)
+	if errors.Is(err, unix.EINVAL) || errors.Is(err, unix.ENOSYS) || errors.Is(err, unix.EOPNOTSUPP) {
+		return ErrNoExchange
+	}
+	return err
+}
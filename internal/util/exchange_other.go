@@ -0,0 +1,13 @@
+//go:build !linux
+
+package util
+
+import "errors"
+
+// ErrNoExchange is returned by Exchange where paths can't be swapped atomically.
+var ErrNoExchange = errors.New("atomic exchange not supported")
+
+// Exchange is only implemented on Linux, where renameat2 is.
+func Exchange(a, b string) error {
+	return ErrNoExchange
+}
@@ -0,0 +1,7 @@
+package util
+
+// FileID identifies a file on disk regardless of the path used to reach it.
+type FileID struct {
+	Dev uint64
+	Ino uint64
+}
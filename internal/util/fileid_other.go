@@ -0,0 +1,10 @@
+//go:build !unix
+
+package util
+
+import "io/fs"
+
+// FileIDOf is not supported on this platform, callers fall back to comparing resolved paths.
+func FileIDOf(fi fs.FileInfo) (FileID, bool) {
+	return FileID{}, false
+}
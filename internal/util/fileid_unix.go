@@ -0,0 +1,17 @@
+//go:build unix
+
+package util
+
+import (
+	"io/fs"
+	"syscall"
+)
+
+// FileIDOf returns the device and inode numbers of the file described by fi.
+func FileIDOf(fi fs.FileInfo) (FileID, bool) {
+	st, ok := fi.Sys().(*syscall.Stat_t)
+	if !ok {
+		return FileID{}, false
+	}
+	return FileID{Dev: uint64(st.Dev), Ino: uint64(st.Ino)}, true
+}
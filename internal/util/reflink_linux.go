@@ -0,0 +1,44 @@
+//go:build linux
+
+package util
+
+import (
+	"errors"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// Reflink makes dst, which must not exist, a copy-on-write clone of src: a file of its own that
+// shares src's blocks until either is written to. Only filesystems like btrfs and xfs can, and
+// only within themselves.
+func Reflink(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	fi, err := in.Stat()
+	if err != nil {
+		return err
+	}
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, fi.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	err = unix.IoctlFileClone(int(out.Fd()), int(in.Fd()))
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		_ = os.Remove(dst)
+		switch {
+		case errors.Is(err, unix.EXDEV):
+			return errors.New("source and output are on different filesystems")
+		case errors.Is(err, unix.EOPNOTSUPP), errors.Is(err, unix.EINVAL), errors.Is(err, unix.ENOTTY):
+			return errors.New("the filesystem doesn't support reflinks")
+		}
+		return err
+	}
+	return os.Chtimes(dst, fi.ModTime(), fi.ModTime())
+}
@@ -0,0 +1,10 @@
+//go:build !linux
+
+package util
+
+import "errors"
+
+// Reflink is only implemented on Linux, where FICLONE is.
+func Reflink(src, dst string) error {
+	return errors.New("reflinks are only supported on Linux")
+}
@@ -2,30 +2,53 @@ package util
 
 import (
 	"fmt"
-	"github.com/rs/zerolog/log"
 	"os"
 	"path/filepath"
-	"runtime"
+	"strings"
+
+	"github.com/rs/zerolog/log"
 )
 
-// APath is a wrapper for filepath.Abs for convenience and flexibility.
-func APath(path string, relative bool) string {
-	basepath := "/"
-	// TODO: make this more gooder
-	if runtime.GOOS == "windows" {
-		basepath = "c:\\"
+// ExpandHome replaces a leading "~" in path with the current user's home directory.
+func ExpandHome(path string) (string, error) {
+	if path != "~" && !strings.HasPrefix(path, "~/") && !strings.HasPrefix(path, `~`+string(filepath.Separator)) {
+		return path, nil
 	}
-	if relative {
-		return path
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return path, err
 	}
-	abs, err := filepath.Abs(basepath + path)
+	return filepath.Join(home, path[1:]), nil
+}
+
+// APath is a wrapper for filepath.Abs for convenience and flexibility, it also expands a leading "~".
+func APath(path string) string {
+	expanded, err := ExpandHome(strings.TrimSpace(path))
 	if err != nil {
-		log.Warn().Caller(1).Str("caller", path).Err(err).Msg("unable to get absolute path")
-		return path
+		log.Warn().Caller(1).Str("path", path).Err(err).Msg("unable to expand home directory")
+	}
+	abs, err := filepath.Abs(expanded)
+	if err != nil {
+		log.Warn().Caller(1).Str("path", path).Err(err).Msg("unable to get absolute path")
+		return expanded
 	}
 	return abs
 }
 
+// LinkTarget returns what a link at linkPath should point at to reach target.
+// When relative is set the result is relative to the directory containing the link,
+// so a tree of such links survives its drive being mounted elsewhere.
+func LinkTarget(target, linkPath string, relative bool) (string, error) {
+	if !relative {
+		return target, nil
+	}
+	rel, err := filepath.Rel(filepath.Dir(linkPath), target)
+	if err != nil {
+		return target, fmt.Errorf("failed to make %s relative to %s: %w", target, linkPath, err)
+	}
+	return rel, nil
+}
+
 func FreshLink(path string) error {
 	if _, err := os.Lstat(path); err == nil {
 		if err := os.Remove(path); err != nil {
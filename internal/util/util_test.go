@@ -0,0 +1,41 @@
+package util
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestLinkTarget(t *testing.T) {
+	target := "/mnt/drive/samples/Kicks/kick_01.wav"
+	link := "/mnt/drive/library/Drums/Kicks/kick_01.wav"
+
+	if got, _ := LinkTarget(target, link, false); got != target {
+		t.Errorf("absolute LinkTarget() = %q, want %q", got, target)
+	}
+	got, err := LinkTarget(target, link, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "../../../samples/Kicks/kick_01.wav"; got != want {
+		t.Errorf("relative LinkTarget() = %q, want %q", got, want)
+	}
+	if resolved := filepath.Join(filepath.Dir(link), got); resolved != target {
+		t.Errorf("relative target resolves to %q, want %q", resolved, target)
+	}
+}
+
+func TestExpandHome(t *testing.T) {
+	t.Setenv("HOME", "/home/kayos")
+	tests := map[string]string{
+		"~":         "/home/kayos",
+		"~/samples": "/home/kayos/samples",
+		"samples/~": "samples/~",
+		"/abs/path": "/abs/path",
+		"~other":    "~other",
+	}
+	for in, want := range tests {
+		if got, _ := ExpandHome(in); got != want {
+			t.Errorf("ExpandHome(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
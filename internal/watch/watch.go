@@ -0,0 +1,70 @@
+// Package watch reports changes under a set of directory trees, batched so that a pack being
+// unzipped or copied in arrives as one batch rather than thousands of events.
+package watch
+
+import (
+	"io/fs"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// Skip decides whether path, a file or directory inside a watched tree, is of no interest.
+// Skipped directories are not watched at all.
+type Skip func(path string, isDir bool) bool
+
+// Handler is called with every batch of changed paths, sorted. A path may be a file or a
+// directory that was created, written, moved in or out, or deleted; look at the disk to tell which.
+type Handler func(paths []string)
+
+// batch collects changed paths until things have been quiet for the debounce delay.
+type batch struct {
+	debounce time.Duration
+	paths    map[string]struct{}
+	quietAt  time.Time
+}
+
+func newBatch(debounce time.Duration) *batch {
+	return &batch{debounce: debounce, paths: make(map[string]struct{})}
+}
+
+func (b *batch) add(path string, now time.Time) {
+	b.paths[path] = struct{}{}
+	b.quietAt = now.Add(b.debounce)
+}
+
+// flush returns the batch if it's ready, emptying it.
+func (b *batch) flush(now time.Time) []string {
+	if len(b.paths) == 0 || now.Before(b.quietAt) {
+		return nil
+	}
+	paths := make([]string, 0, len(b.paths))
+	for p := range b.paths {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+	b.paths = make(map[string]struct{})
+	return paths
+}
+
+// dirsUnder lists root and every directory below it that isn't skipped, named as they are under
+// root. root itself may be a symlink, such as ~/Samples -> /mnt/drive, real is where it leads.
+func dirsUnder(root string, skip Skip) (real string, dirs []string) {
+	real, err := filepath.EvalSymlinks(root)
+	if err != nil {
+		return root, nil
+	}
+	_ = filepath.WalkDir(real, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || !d.IsDir() {
+			return nil
+		}
+		rel, _ := filepath.Rel(real, path)
+		path = filepath.Join(root, rel)
+		if rel != "." && skip != nil && skip(path, true) {
+			return filepath.SkipDir
+		}
+		dirs = append(dirs, path)
+		return nil
+	})
+	return real, dirs
+}
@@ -0,0 +1,181 @@
+//go:build linux
+
+package watch
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+const watchMask = unix.IN_CREATE | unix.IN_CLOSE_WRITE | unix.IN_DELETE | unix.IN_MOVED_FROM |
+	unix.IN_MOVED_TO | unix.IN_ONLYDIR | unix.IN_DONT_FOLLOW | unix.IN_EXCL_UNLINK
+
+// pollInterval is how often Run checks for stop while nothing happens.
+const pollInterval = 250 * time.Millisecond
+
+// Watcher watches directory trees with inotify.
+type Watcher struct {
+	fd    int
+	skip  Skip
+	roots []string
+	// dirs maps watch descriptors to the directory they watch.
+	dirs map[int]string
+	mu   *sync.Mutex
+	// Warn, if set, is called with problems that don't stop the watcher, like a full event queue.
+	Warn func(error)
+}
+
+// New creates a Watcher, skip may be nil.
+func New(skip Skip) (*Watcher, error) {
+	fd, err := unix.InotifyInit1(unix.IN_CLOEXEC | unix.IN_NONBLOCK)
+	if err != nil {
+		return nil, fmt.Errorf("inotify: %w", err)
+	}
+	return &Watcher{fd: fd, skip: skip, dirs: make(map[int]string), mu: &sync.Mutex{}}, nil
+}
+
+// Add watches root and every directory below it.
+func (w *Watcher) Add(root string) error {
+	w.mu.Lock()
+	w.roots = append(w.roots, root)
+	w.mu.Unlock()
+	return w.addTree(root)
+}
+
+func (w *Watcher) addTree(root string) error {
+	var errs []error
+	real, dirs := dirsUnder(root, w.skip)
+	for _, dir := range dirs {
+		// watched where it really is, IN_DONT_FOLLOW would refuse a symlinked root
+		rel, _ := filepath.Rel(root, dir)
+		wd, err := unix.InotifyAddWatch(w.fd, filepath.Join(real, rel), watchMask)
+		if err != nil {
+			if errors.Is(err, unix.ENOSPC) {
+				return fmt.Errorf("out of inotify watches at %s, raise fs.inotify.max_user_watches", dir)
+			}
+			errs = append(errs, fmt.Errorf("watch %s: %w", dir, err))
+			continue
+		}
+		w.mu.Lock()
+		w.dirs[wd] = dir
+		w.mu.Unlock()
+	}
+	return errors.Join(errs...)
+}
+
+// forgetTree stops watching dir and everything below it, for directories moved away.
+func (w *Watcher) forgetTree(dir string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for wd, path := range w.dirs {
+		if path == dir || strings.HasPrefix(path, dir+string(filepath.Separator)) {
+			_, _ = unix.InotifyRmWatch(w.fd, uint32(wd))
+			delete(w.dirs, wd)
+		}
+	}
+}
+
+// Watched counts the directories being watched.
+func (w *Watcher) Watched() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return len(w.dirs)
+}
+
+// Close stops watching everything.
+func (w *Watcher) Close() error {
+	return unix.Close(w.fd)
+}
+
+func (w *Watcher) warn(err error) {
+	if w.Warn != nil {
+		w.Warn(err)
+	}
+}
+
+// Run reads events until stop is closed, calling handle with a batch of changed paths
+// whenever debounce has passed without new events.
+func (w *Watcher) Run(stop <-chan struct{}, debounce time.Duration, handle Handler) error {
+	var buf [64 * 1024]byte
+	pending := newBatch(debounce)
+	fds := []unix.PollFd{{Fd: int32(w.fd), Events: unix.POLLIN}}
+	for {
+		select {
+		case <-stop:
+			return nil
+		default:
+		}
+		n, err := unix.Poll(fds, int(pollInterval/time.Millisecond))
+		if err != nil && !errors.Is(err, unix.EINTR) {
+			return fmt.Errorf("poll: %w", err)
+		}
+		if n > 0 {
+			read, err := unix.Read(w.fd, buf[:])
+			switch {
+			case errors.Is(err, unix.EAGAIN), errors.Is(err, unix.EINTR):
+			case err != nil:
+				return fmt.Errorf("read inotify events: %w", err)
+			default:
+				w.parse(buf[:read], pending)
+			}
+		}
+		if paths := pending.flush(time.Now()); paths != nil {
+			handle(paths)
+		}
+	}
+}
+
+// parse turns a buffer of raw events into changed paths.
+func (w *Watcher) parse(buf []byte, pending *batch) {
+	now := time.Now()
+	for off := 0; off+unix.SizeofInotifyEvent <= len(buf); {
+		ev := (*unix.InotifyEvent)(unsafe.Pointer(&buf[off]))
+		nameBytes := buf[off+unix.SizeofInotifyEvent : off+unix.SizeofInotifyEvent+int(ev.Len)]
+		off += unix.SizeofInotifyEvent + int(ev.Len)
+		name := strings.TrimRight(string(nameBytes), "\x00")
+
+		if ev.Mask&unix.IN_Q_OVERFLOW != 0 {
+			// we lost events, have the handler look at everything again
+			w.warn(errors.New("inotify event queue overflowed, rescanning every root"))
+			w.mu.Lock()
+			for _, root := range w.roots {
+				pending.add(root, now)
+			}
+			w.mu.Unlock()
+			continue
+		}
+		w.mu.Lock()
+		dir, ok := w.dirs[int(ev.Wd)]
+		if ev.Mask&unix.IN_IGNORED != 0 {
+			delete(w.dirs, int(ev.Wd))
+		}
+		w.mu.Unlock()
+		if !ok || name == "" {
+			continue
+		}
+		path := filepath.Join(dir, name)
+		isDir := ev.Mask&unix.IN_ISDIR != 0
+		if w.skip != nil && w.skip(path, isDir) {
+			continue
+		}
+		if isDir {
+			switch {
+			case ev.Mask&(unix.IN_CREATE|unix.IN_MOVED_TO) != 0:
+				// whatever lands in it before the watch is in place is found when the handler walks it
+				if err := w.addTree(path); err != nil {
+					w.warn(err)
+				}
+			case ev.Mask&unix.IN_MOVED_FROM != 0:
+				w.forgetTree(path)
+			}
+		}
+		pending.add(path, now)
+	}
+}
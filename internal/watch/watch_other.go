@@ -0,0 +1,26 @@
+//go:build !linux
+
+package watch
+
+import (
+	"errors"
+	"time"
+)
+
+// Watcher is only implemented on Linux, where inotify is.
+type Watcher struct {
+	Warn func(error)
+}
+
+// New always fails on this platform.
+func New(skip Skip) (*Watcher, error) {
+	return nil, errors.New("watching needs inotify, which only Linux has")
+}
+
+func (w *Watcher) Add(root string) error { return nil }
+
+func (w *Watcher) Watched() int { return 0 }
+
+func (w *Watcher) Close() error { return nil }
+
+func (w *Watcher) Run(stop <-chan struct{}, debounce time.Duration, handle Handler) error { return nil }
@@ -0,0 +1,139 @@
+package watch
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestBatch(t *testing.T) {
+	start := time.Now()
+	b := newBatch(time.Second)
+	b.add("/b", start)
+	b.add("/a", start.Add(500*time.Millisecond))
+	b.add("/b", start.Add(600*time.Millisecond))
+	if got := b.flush(start.Add(time.Second)); got != nil {
+		t.Errorf("flushed %v before things settled", got)
+	}
+	if got := b.flush(start.Add(1600 * time.Millisecond)); !reflect.DeepEqual(got, []string{"/a", "/b"}) {
+		t.Errorf("flushed %v, want [/a /b]", got)
+	}
+	if got := b.flush(start.Add(time.Hour)); got != nil {
+		t.Errorf("flushed %v twice", got)
+	}
+}
+
+func TestWatcher(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("inotify only")
+	}
+	root := t.TempDir()
+	if err := os.Mkdir(filepath.Join(root, "skipped"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	w, err := New(func(path string, isDir bool) bool { return filepath.Base(path) == "skipped" })
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	if err = w.Add(root); err != nil {
+		t.Fatal(err)
+	}
+	if w.Watched() != 1 {
+		t.Errorf("watching %d directories, want 1", w.Watched())
+	}
+
+	batches := make(chan []string, 4)
+	stop := make(chan struct{})
+	done := make(chan error)
+	go func() { done <- w.Run(stop, 100*time.Millisecond, func(paths []string) { batches <- paths }) }()
+
+	pack := filepath.Join(root, "pack")
+	if err = os.Mkdir(pack, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	// give the watcher a moment to pick up the new directory, then write into it
+	time.Sleep(50 * time.Millisecond)
+	for _, name := range []string{filepath.Join(pack, "kick.wav"), filepath.Join(root, "skipped", "x.wav")} {
+		if err = os.WriteFile(name, []byte("RIFF"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var got []string
+	select {
+	case got = <-batches:
+	case <-time.After(5 * time.Second):
+		t.Fatal("no batch")
+	}
+	want := []string{pack, filepath.Join(pack, "kick.wav")}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("batch = %v, want %v", got, want)
+	}
+
+	if err = os.Rename(pack, filepath.Join(root, "moved")); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case got = <-batches:
+	case <-time.After(5 * time.Second):
+		t.Fatal("no batch")
+	}
+	if want = []string{filepath.Join(root, "moved"), pack}; !reflect.DeepEqual(got, want) {
+		t.Errorf("batch = %v, want %v", got, want)
+	}
+
+	close(stop)
+	if err = <-done; err != nil {
+		t.Error(err)
+	}
+}
+
+func TestWatcher_SymlinkedRoot(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("inotify only")
+	}
+	real := t.TempDir()
+	if err := os.Mkdir(filepath.Join(real, "pack"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	root := filepath.Join(t.TempDir(), "Samples")
+	if err := os.Symlink(real, root); err != nil {
+		t.Fatal(err)
+	}
+	w, err := New(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	if err = w.Add(root); err != nil {
+		t.Fatal(err)
+	}
+	if w.Watched() != 2 {
+		t.Errorf("watching %d directories, want 2", w.Watched())
+	}
+
+	batches := make(chan []string, 4)
+	stop := make(chan struct{})
+	done := make(chan error)
+	go func() { done <- w.Run(stop, 100*time.Millisecond, func(paths []string) { batches <- paths }) }()
+	if err = os.WriteFile(filepath.Join(real, "pack", "kick.wav"), []byte("RIFF"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case got := <-batches:
+		// reported under the root as given, like scan names them
+		if want := []string{filepath.Join(root, "pack", "kick.wav")}; !reflect.DeepEqual(got, want) {
+			t.Errorf("batch = %v, want %v", got, want)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no batch")
+	}
+	close(stop)
+	if err = <-done; err != nil {
+		t.Error(err)
+	}
+}